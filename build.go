@@ -0,0 +1,236 @@
+package radix
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	"github.com/google/btree"
+)
+
+// Entry represents item stored in a trie under some path.
+type Entry[T any] struct {
+	Path    Path
+	Item    T
+	Payload any
+}
+
+// Build creates new trie of uint items from entries returned by next.
+// See BuildOf for details.
+func Build(next func() (Entry[uint], bool), config *TrieConfig) *Trie {
+	return BuildOf(next, config, cmp.Compare[uint])
+}
+
+// BuildOf creates new trie of items of type T from entries returned by next.
+// It calls next until it returns false.
+//
+// Unlike sequential Insert calls, BuildOf groups entries by keys and values
+// and constructs leafs and nodes directly, without any locking. Keys from
+// config's NodeOrder are placed first as Insert does; other keys are placed
+// from the most frequent to the least frequent within every subtree.
+// Resulting trie is equal in semantics to the one created by inserting every
+// entry in order (that is, the latest payload wins for duplicate entries).
+//
+// If config's BuildWorkers is greater than one, independent top level
+// subtrees are built by that number of goroutines.
+func BuildOf[T any](next func() (Entry[T], bool), config *TrieConfig, compare func(a, b T) int) *TrieOf[T] {
+	t := NewOf(config, compare)
+
+	var entries []buildEntry[T]
+	for {
+		e, ok := next()
+		if !ok {
+			break
+		}
+		entries = append(entries, buildEntry[T]{
+			path: e.Path,
+			item: leafItem[T]{e.Item, e.Payload},
+			seq:  len(entries),
+		})
+	}
+
+	root := t.root.Load()
+	b := builder[T]{
+		cmp:       compare,
+		kinds:     root.kinds,
+		nodeOrder: t.inserter.NodeOrder,
+		indexNode: t.inserter.IndexNode,
+	}
+	var workers int
+	if config != nil {
+		workers = config.BuildWorkers
+	}
+	if workers <= 1 {
+		b.build(root, entries, b.nodeOrder, nil)
+	} else {
+		b.buildParallel(root, entries, workers)
+	}
+
+	if t.index != nil {
+		t.index.addTree(root)
+	}
+	if t.log != nil {
+		t.log.begin()
+		t.log.reset(root)
+		t.log.end()
+	}
+
+	return t
+}
+
+type buildEntry[T any] struct {
+	path Path
+	item leafItem[T]
+	seq  int
+}
+
+type builder[T any] struct {
+	cmp       func(a, b T) int
+	kinds     *keyKinds
+	nodeOrder []uint
+	indexNode func(*NodeOf[T])
+}
+
+// subtree is a child leaf of a node that is not built yet.
+type subtree[T any] struct {
+	leaf    *LeafOf[T]
+	entries []buildEntry[T]
+	order   []uint
+}
+
+// build fills leaf with given entries. If spawn is non-nil, it is called for
+// every child leaf instead of building it recursively.
+func (b *builder[T]) build(leaf *LeafOf[T], entries []buildEntry[T], order []uint, spawn func(subtree[T])) {
+	var (
+		items []buildEntry[T]
+		nodes treap[uint, *NodeOf[T]]
+	)
+	for len(entries) > 0 {
+		var (
+			key uint
+			ok  bool
+		)
+		if len(order) > 0 {
+			key, order, ok = order[0], order[1:], true
+		} else {
+			key, ok = b.majorKey(entries)
+		}
+		if !ok {
+			// All entries are ended up here.
+			items = entries
+			break
+		}
+
+		var rest []buildEntry[T]
+		groups := make(map[string][]buildEntry[T])
+		for _, e := range entries {
+			v, has := e.path.Get(key)
+			if !has {
+				rest = append(rest, e)
+				continue
+			}
+			e.path = e.path.Without(key)
+			groups[string(v)] = append(groups[string(v)], e)
+		}
+		entries = rest
+		if len(groups) == 0 {
+			continue
+		}
+
+		n := &NodeOf[T]{
+			key:    key,
+			cmp:    b.cmp,
+			kinds:  b.kinds,
+			parent: leaf,
+		}
+		if b.indexNode != nil {
+			b.indexNode(n)
+		}
+		for v, group := range groups {
+			child := NewLeafOf(n, v, b.cmp)
+			n.values = n.values.Set(v, child)
+			st := subtree[T]{child, group, order}
+			if spawn != nil {
+				spawn(st)
+			} else {
+				b.build(st.leaf, st.entries, st.order, nil)
+			}
+		}
+		nodes = nodes.Set(key, n)
+	}
+
+	leaf.setNodes(nodes)
+	b.fill(leaf, items)
+}
+
+func (b *builder[T]) buildParallel(root *LeafOf[T], entries []buildEntry[T], workers int) {
+	var (
+		wg    sync.WaitGroup
+		queue = make(chan subtree[T])
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for st := range queue {
+				b.build(st.leaf, st.entries, st.order, nil)
+			}
+		}()
+	}
+	b.build(root, entries, b.nodeOrder, func(st subtree[T]) {
+		queue <- st
+	})
+	close(queue)
+	wg.Wait()
+}
+
+// majorKey returns the most frequent key among entries paths.
+// It returns false if all entries have empty paths.
+func (b *builder[T]) majorKey(entries []buildEntry[T]) (key uint, ok bool) {
+	count := make(map[uint]int)
+	for _, e := range entries {
+		e.path.Ascend(e.path.Begin(), func(p Pair) bool {
+			count[p.Key]++
+			return true
+		})
+	}
+	var max int
+	for k, n := range count {
+		if n > max || (n == max && k < key) {
+			key, max, ok = k, n, true
+		}
+	}
+	return key, ok
+}
+
+// fill stores items of given entries in the leaf.
+// For duplicate items the latest entry wins.
+func (b *builder[T]) fill(leaf *LeafOf[T], entries []buildEntry[T]) {
+	slices.SortStableFunc(entries, func(x, y buildEntry[T]) int {
+		if c := b.cmp(x.item.value, y.item.value); c != 0 {
+			return c
+		}
+		return x.seq - y.seq
+	})
+	items := make([]leafItem[T], 0, len(entries))
+	for _, e := range entries {
+		if n := len(items); n > 0 && b.cmp(items[n-1].value, e.item.value) == 0 {
+			items[n-1] = e.item
+			continue
+		}
+		items = append(items, e.item)
+	}
+	fillLeaf(leaf, items)
+}
+
+// fillLeaf stores items in the empty leaf. Items must be sorted and unique.
+func fillLeaf[T any](leaf *LeafOf[T], items []leafItem[T]) {
+	if len(items) <= leaf.array.Cap() {
+		leaf.array.size = copy(leaf.array.data[:], items)
+		return
+	}
+	leaf.btree = btree.NewG(degree, leaf.less)
+	for _, x := range items {
+		leaf.btree.ReplaceOrInsert(x)
+	}
+}
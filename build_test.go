@@ -0,0 +1,180 @@
+package radix_test
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	. "github.com/gobwas/radix"
+	"github.com/gobwas/radix/listing"
+)
+
+func TestBuild(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config *TrieConfig
+	}{
+		{"default", nil},
+		{"order", &TrieConfig{NodeOrder: []uint{3, 1}}},
+		{"parallel", &TrieConfig{BuildWorkers: 4}},
+		{"parallel order", &TrieConfig{NodeOrder: []uint{2}, BuildWorkers: 4}},
+		{"index", &TrieConfig{ReverseIndex: true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			entries := randEntries(500)
+
+			exp := New(test.config)
+			for _, e := range entries {
+				exp.InsertWithPayload(e.Path, e.Item, e.Payload)
+			}
+			var i int
+			act := Build(func() (e Entry[uint], ok bool) {
+				if i < len(entries) {
+					e, ok = entries[i], true
+					i++
+				}
+				return
+			}, test.config)
+
+			for _, e := range entries {
+				for _, lookup := range []func(*Trie) map[string]int{
+					func(trie *Trie) map[string]int {
+						m := map[string]int{}
+						trie.LookupStrictWithPayload(e.Path, func(v uint, p any) bool {
+							m[fmt.Sprint(v, p)]++
+							return true
+						})
+						return m
+					},
+					func(trie *Trie) map[string]int {
+						m := map[string]int{}
+						trie.LookupGreedyWithPayload(e.Path, func(v uint, p any) bool {
+							m[fmt.Sprint(v, p)]++
+							return true
+						})
+						return m
+					},
+				} {
+					if a, b := lookup(act), lookup(exp); !reflect.DeepEqual(a, b) {
+						t.Fatalf(
+							"lookup(%v) on built trie = %v; want %v\nTrie:\n%s",
+							e.Path, a, b, listing.DumpString(act),
+						)
+					}
+				}
+			}
+			if a, b := act.ItemCount(Path{}), exp.ItemCount(Path{}); a != b {
+				t.Errorf("ItemCount() of built trie = %d; want %d", a, b)
+			}
+			if test.config != nil && test.config.ReverseIndex {
+				for v := uint(0); v < 10; v++ {
+					if a, b := pathStrings(act.PathsOf(v)), pathStrings(exp.PathsOf(v)); !reflect.DeepEqual(a, b) {
+						t.Errorf("PathsOf(%d) of built trie = %v; want %v", v, a, b)
+					}
+				}
+			}
+
+			// Built trie must stay usable for regular mutations.
+			p := PathFromMapStr(map[uint]string{1: "x", 5: "y"})
+			act.Insert(p, 42)
+			var found bool
+			act.LookupStrict(p, func(v uint) bool {
+				found = v == 42
+				return !found
+			})
+			if !found {
+				t.Errorf("item inserted after Build() is not found")
+			}
+		})
+	}
+}
+
+func TestBuildDuplicates(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config *TrieConfig
+	}{
+		// Node order covers all keys of randEntries, thus duplicate entries
+		// are inserted to the same leaf regardless of the trie shape.
+		{"default", &TrieConfig{NodeOrder: []uint{0, 1, 2, 3, 4, 5}}},
+		{"parallel", &TrieConfig{NodeOrder: []uint{0, 1, 2, 3, 4, 5}, BuildWorkers: 4}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				entries []Entry[uint]
+				paths   = randEntries(50)
+			)
+			// Insert every (path, item) pair several times with different
+			// payloads, so the latest payload must win.
+			for i := 0; i < 3; i++ {
+				for _, e := range paths {
+					for v := uint(0); v < 2*LeafArrayCapacity; v++ {
+						entries = append(entries, Entry[uint]{
+							Path:    e.Path,
+							Item:    v,
+							Payload: len(entries),
+						})
+					}
+				}
+			}
+			rand.Shuffle(len(entries), func(i, j int) {
+				entries[i], entries[j] = entries[j], entries[i]
+			})
+
+			exp := New(test.config)
+			for _, e := range entries {
+				exp.InsertWithPayload(e.Path, e.Item, e.Payload)
+			}
+			var i int
+			act := Build(func() (e Entry[uint], ok bool) {
+				if i < len(entries) {
+					e, ok = entries[i], true
+					i++
+				}
+				return
+			}, test.config)
+
+			lookup := func(trie *Trie, p Path) map[uint]any {
+				m := map[uint]any{}
+				trie.LookupStrictWithPayload(p, func(v uint, p any) bool {
+					m[v] = p
+					return true
+				})
+				return m
+			}
+			for _, e := range paths {
+				if a, b := lookup(act, e.Path), lookup(exp, e.Path); !reflect.DeepEqual(a, b) {
+					t.Fatalf("lookup(%v) on built trie = %v; want %v", e.Path, a, b)
+				}
+			}
+			if a, b := act.ItemCount(Path{}), exp.ItemCount(Path{}); a != b {
+				t.Errorf("ItemCount() of built trie = %d; want %d", a, b)
+			}
+		})
+	}
+}
+
+// randEntries returns n entries with unique (path, item) pairs.
+func randEntries(n int) []Entry[uint] {
+	var (
+		ret  = make([]Entry[uint], 0, n)
+		seen = map[string]bool{}
+	)
+	for len(ret) < n {
+		m := map[uint]string{}
+		for j, k := 0, rand.Intn(5); j < k; j++ {
+			m[uint(rand.Intn(6))] = fmt.Sprintf("v%d", rand.Intn(3))
+		}
+		e := Entry[uint]{
+			Path:    PathFromMapStr(m),
+			Item:    uint(rand.Intn(10)),
+			Payload: len(ret),
+		}
+		if k := fmt.Sprint(e.Path.String(), e.Item); !seen[k] {
+			seen[k] = true
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,496 @@
+package radix
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Binary representation of a trie is as follows:
+//
+//	trie     = magic version leaf checksum
+//	leaf     = count(items) *item count(payloads) *payload count(nodes) *node
+//	item     = uvarint(zigzag(item - previous item))
+//	payload  = uvarint(item index) bytes
+//	node     = uvarint(key) count(leafs) *(bytes leaf)
+//	bytes    = count(data) data
+//	count    = uvarint
+//	checksum = CRC-32C of all preceding bytes in big endian
+//
+// Nodes are written in the order they are stored in the leaf, thus decoded
+// trie has exactly the same shape as the encoded one.
+const (
+	binaryMagic   = "RDXT"
+	binaryVersion = 1
+)
+
+var (
+	// ErrInvalidFormat is returned by decoders when data is not a binary
+	// representation of a trie.
+	ErrInvalidFormat = errors.New("radix: invalid binary format")
+
+	// ErrChecksum is returned by decoders when data is corrupted.
+	ErrChecksum = errors.New("radix: checksum mismatch")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// See EncoderOf for details.
+func (t *TrieOf[T]) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := NewEncoderOf[T](&buf).Encode(t); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// It replaces trie contents with the decoded one.
+// See DecoderOf for details.
+func (t *TrieOf[T]) UnmarshalBinary(data []byte) error {
+	d := NewDecoderOf[T](bytes.NewReader(data))
+	root, err := d.decode(t)
+	if err == io.EOF {
+		return d.error(err)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := d.r.r.ReadByte(); err != io.EOF {
+		return fmt.Errorf("%w: trailing data", ErrInvalidFormat)
+	}
+	t.beginWrite(true)
+	defer t.endWrite(true)
+	t.replaceRoot(root)
+	return nil
+}
+
+// Encoder is an EncoderOf uint items.
+type Encoder = EncoderOf[uint]
+
+// EncoderOf writes binary representation of tries of items of type T.
+// T must be one of the predeclared integer types.
+type EncoderOf[T any] struct {
+	// EncodePayload is used to encode non-nil item payloads. If it is nil,
+	// encoding of a trie with payloads fails.
+	EncodePayload func(any) ([]byte, error)
+
+	w   *bufio.Writer
+	buf []byte
+	sum uint32
+}
+
+// NewEncoder creates encoder of uint items tries writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return NewEncoderOf[uint](w)
+}
+
+// NewEncoderOf creates encoder of tries of items of type T writing to w.
+func NewEncoderOf[T any](w io.Writer) *EncoderOf[T] {
+	return &EncoderOf[T]{
+		w: bufio.NewWriter(w),
+	}
+}
+
+// Encode writes binary representation of t. Every call of Encode writes
+// independent representation which could be read by one Decode call.
+//
+// Encode reads t as lookups do, without blocking them or mutations. Note that
+// for non-persistent trie mutations made concurrently with Encode could be
+// written partially; encode t.Snapshot() if consistent state is needed.
+func (e *EncoderOf[T]) Encode(t *TrieOf[T]) error {
+	conv, ok := itemConvOf[T]()
+	if !ok {
+		return fmt.Errorf("radix: could not encode items of type %T", *new(T))
+	}
+	e.sum = 0
+	e.buf = append(e.buf[:0], binaryMagic...)
+	e.buf = append(e.buf, binaryVersion)
+	e.write(e.buf)
+	if err := e.leaf(t.root.Load(), conv); err != nil {
+		return err
+	}
+	e.buf = binary.BigEndian.AppendUint32(e.buf[:0], e.sum)
+	if _, err := e.w.Write(e.buf); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+func (e *EncoderOf[T]) write(p []byte) {
+	e.sum = crc32.Update(e.sum, crcTable, p)
+	// Error is returned later by Flush().
+	e.w.Write(p)
+}
+
+func (e *EncoderOf[T]) leaf(l *LeafOf[T], conv itemConv[T]) error {
+	var items []leafItem[T]
+	l.ascend(func(x leafItem[T]) bool {
+		items = append(items, x)
+		return true
+	})
+	var (
+		prev     uint64
+		payloads int
+	)
+	e.buf = binary.AppendUvarint(e.buf[:0], uint64(len(items)))
+	for _, x := range items {
+		v := conv.to(x.value)
+		e.buf = binary.AppendUvarint(e.buf, zigzag(v-prev))
+		prev = v
+		if x.payload != nil {
+			payloads++
+		}
+	}
+	e.buf = binary.AppendUvarint(e.buf, uint64(payloads))
+	for i, x := range items {
+		if x.payload == nil {
+			continue
+		}
+		if e.EncodePayload == nil {
+			return fmt.Errorf("radix: could not encode payload of %v: EncodePayload is not set", x.value)
+		}
+		p, err := e.EncodePayload(x.payload)
+		if err != nil {
+			return fmt.Errorf("radix: could not encode payload of %v: %w", x.value, err)
+		}
+		e.buf = binary.AppendUvarint(e.buf, uint64(i))
+		e.buf = binary.AppendUvarint(e.buf, uint64(len(p)))
+		e.buf = append(e.buf, p...)
+	}
+	nodes := l.nodes()
+	e.buf = binary.AppendUvarint(e.buf, uint64(nodes.Len()))
+	e.write(e.buf)
+
+	var err error
+	nodes.Ascend(func(key uint, n *NodeOf[T]) bool {
+		values := n.leafs()
+		e.buf = binary.AppendUvarint(e.buf[:0], uint64(key))
+		e.buf = binary.AppendUvarint(e.buf, uint64(values.Len()))
+		e.write(e.buf)
+		return values.Ascend(func(v string, leaf *LeafOf[T]) bool {
+			e.buf = binary.AppendUvarint(e.buf[:0], uint64(len(v)))
+			e.buf = append(e.buf, v...)
+			e.write(e.buf)
+			err = e.leaf(leaf, conv)
+			return err == nil
+		})
+	})
+	return err
+}
+
+// Decoder is a DecoderOf uint items.
+type Decoder = DecoderOf[uint]
+
+// DecoderOf reads binary representation of tries of items of type T written
+// by EncoderOf.
+type DecoderOf[T any] struct {
+	// DecodePayload is used to decode item payloads. If it is nil, decoding
+	// of a trie with payloads fails.
+	DecodePayload func([]byte) (any, error)
+
+	r checksumReader
+}
+
+// NewDecoder creates decoder of uint items tries reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderOf[uint](r)
+}
+
+// NewDecoderOf creates decoder of tries of items of type T reading from r.
+func NewDecoderOf[T any](r io.Reader) *DecoderOf[T] {
+	return &DecoderOf[T]{
+		r: checksumReader{r: bufio.NewReader(r)},
+	}
+}
+
+// Decode reads binary representation of a trie and replaces t's contents
+// with it. Items are expected to be ordered with respect to t's compare
+// function.
+//
+// It returns io.EOF if there is no more data to read. It returns errors
+// wrapping ErrInvalidFormat or ErrChecksum if data is malformed or corrupted.
+// In case of error t is left untouched.
+func (d *DecoderOf[T]) Decode(t *TrieOf[T]) error {
+	root, err := d.decode(t)
+	if err != nil {
+		return err
+	}
+	t.beginWrite(true)
+	defer t.endWrite(true)
+	t.replaceRoot(root)
+	return nil
+}
+
+func (d *DecoderOf[T]) decode(t *TrieOf[T]) (*LeafOf[T], error) {
+	conv, ok := itemConvOf[T]()
+	if !ok {
+		return nil, fmt.Errorf("radix: could not decode items of type %T", *new(T))
+	}
+	d.r.sum = 0
+	header, err := d.r.read(len(binaryMagic) + 1)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, d.error(err)
+	}
+	if string(header[:len(binaryMagic)]) != binaryMagic {
+		return nil, fmt.Errorf("%w: bad magic %q", ErrInvalidFormat, header[:len(binaryMagic)])
+	}
+	if v := header[len(binaryMagic)]; v != binaryVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidFormat, v)
+	}
+
+	dec := leafDecoder[T]{
+		DecoderOf: d,
+		conv:      conv,
+		cmp:       t.root.Load().cmp,
+		kinds:     t.root.Load().kinds,
+		indexNode: t.inserter.IndexNode,
+	}
+	root, err := dec.leaf(nil, "", 0)
+	if err != nil {
+		return nil, d.error(err)
+	}
+
+	sum := d.r.sum
+	p, err := d.r.read(4)
+	if err != nil {
+		return nil, d.error(err)
+	}
+	if binary.BigEndian.Uint32(p) != sum {
+		return nil, ErrChecksum
+	}
+	return root, nil
+}
+
+func (d *DecoderOf[T]) error(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %w", ErrInvalidFormat, io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+type leafDecoder[T any] struct {
+	*DecoderOf[T]
+	conv      itemConv[T]
+	cmp       func(a, b T) int
+	kinds     *keyKinds
+	indexNode func(*NodeOf[T])
+}
+
+func (d *leafDecoder[T]) leaf(parent *NodeOf[T], value string, depth int) (*LeafOf[T], error) {
+	if depth > MaxPathSize {
+		return nil, fmt.Errorf("%w: trie is too deep", ErrInvalidFormat)
+	}
+	leaf := NewLeafOf(parent, value, d.cmp)
+	leaf.kinds = d.kinds
+
+	n, err := d.r.count()
+	if err != nil {
+		return nil, err
+	}
+	var prev uint64
+	items := make([]leafItem[T], 0, min(n, 1024))
+	for i := 0; i < n; i++ {
+		x, err := d.r.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		prev += unzigzag(x)
+		v := d.conv.from(prev)
+		if i > 0 && d.cmp(items[i-1].value, v) >= 0 {
+			return nil, fmt.Errorf("%w: items are not sorted", ErrInvalidFormat)
+		}
+		items = append(items, leafItem[T]{value: v})
+	}
+	if n, err = d.r.count(); err != nil {
+		return nil, err
+	}
+	for i, last := 0, -1; i < n; i++ {
+		j, err := d.r.count()
+		if err != nil {
+			return nil, err
+		}
+		if j <= last || j >= len(items) {
+			return nil, fmt.Errorf("%w: bad payload index %d", ErrInvalidFormat, j)
+		}
+		last = j
+		p, err := d.r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		if d.DecodePayload == nil {
+			return nil, fmt.Errorf("radix: could not decode payload of %v: DecodePayload is not set", items[j].value)
+		}
+		if items[j].payload, err = d.DecodePayload(append([]byte(nil), p...)); err != nil {
+			return nil, fmt.Errorf("radix: could not decode payload of %v: %w", items[j].value, err)
+		}
+	}
+	fillLeaf(leaf, items)
+
+	if n, err = d.r.count(); err != nil {
+		return nil, err
+	}
+	var nodes treap[uint, *NodeOf[T]]
+	for i := 0; i < n; i++ {
+		key, err := d.r.count()
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && uint(key) <= nodes.Max() {
+			return nil, fmt.Errorf("%w: nodes are not sorted", ErrInvalidFormat)
+		}
+		m, err := d.r.count()
+		if err != nil {
+			return nil, err
+		}
+		node := &NodeOf[T]{
+			key:    uint(key),
+			cmp:    d.cmp,
+			kinds:  d.kinds,
+			parent: leaf,
+		}
+		if d.indexNode != nil {
+			d.indexNode(node)
+		}
+		for j := 0; j < m; j++ {
+			p, err := d.r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			v := string(p)
+			if _, has := node.values.Get(v); has {
+				return nil, fmt.Errorf("%w: duplicate value %q", ErrInvalidFormat, v)
+			}
+			child, err := d.leaf(node, v, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			node.values = node.values.Set(v, child)
+		}
+		nodes = nodes.Set(node.key, node)
+	}
+	leaf.setNodes(nodes)
+
+	return leaf, nil
+}
+
+// checksumReader computes checksum of the read data.
+type checksumReader struct {
+	r   *bufio.Reader
+	sum uint32
+	buf []byte
+}
+
+func (r *checksumReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.sum = crc32.Update(r.sum, crcTable, []byte{b})
+	}
+	return b, err
+}
+
+// read reads exactly n bytes. Returned slice is valid until next read call.
+func (r *checksumReader) read(n int) ([]byte, error) {
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	m, err := io.ReadFull(r.r, r.buf[:n])
+	r.sum = crc32.Update(r.sum, crcTable, r.buf[:m])
+	return r.buf[:m], err
+}
+
+func (r *checksumReader) uvarint() (uint64, error) {
+	x, err := binary.ReadUvarint(r)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		err = fmt.Errorf("%w: %w", ErrInvalidFormat, err)
+	}
+	return x, err
+}
+
+// count reads uvarint which is used as a number of some elements.
+func (r *checksumReader) count() (int, error) {
+	x, err := r.uvarint()
+	if err == nil && x > uint64(maxInt) {
+		err = fmt.Errorf("%w: count overflow", ErrInvalidFormat)
+	}
+	return int(x), err
+}
+
+func (r *checksumReader) bytes() ([]byte, error) {
+	n, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	return r.read(n)
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+func zigzag(x uint64) uint64 {
+	return (x << 1) ^ uint64(int64(x)>>63)
+}
+
+func unzigzag(x uint64) uint64 {
+	return (x >> 1) ^ -(x & 1)
+}
+
+// itemConv holds functions to convert items of integer type T to uint64 and
+// back.
+type itemConv[T any] struct {
+	to   func(T) uint64
+	from func(uint64) T
+}
+
+// itemConvOf returns itemConv for T. It returns false if T is not an integer
+// type.
+func itemConvOf[T any]() (itemConv[T], bool) {
+	switch any(*new(T)).(type) {
+	case uint:
+		return integerConv[T, uint](), true
+	case uint8:
+		return integerConv[T, uint8](), true
+	case uint16:
+		return integerConv[T, uint16](), true
+	case uint32:
+		return integerConv[T, uint32](), true
+	case uint64:
+		return integerConv[T, uint64](), true
+	case uintptr:
+		return integerConv[T, uintptr](), true
+	case int:
+		return integerConv[T, int](), true
+	case int8:
+		return integerConv[T, int8](), true
+	case int16:
+		return integerConv[T, int16](), true
+	case int32:
+		return integerConv[T, int32](), true
+	case int64:
+		return integerConv[T, int64](), true
+	}
+	return itemConv[T]{}, false
+}
+
+type integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+func integerConv[T any, I integer]() itemConv[T] {
+	return itemConv[T]{
+		to: func(v T) uint64 {
+			return uint64(any(v).(I))
+		},
+		from: func(x uint64) T {
+			return any(I(x)).(T)
+		},
+	}
+}
@@ -0,0 +1,266 @@
+package radix_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	. "github.com/gobwas/radix"
+)
+
+func TestTrieMarshalBinary(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config *TrieConfig
+	}{
+		{"default", nil},
+		{"order", &TrieConfig{NodeOrder: []uint{3, 1}}},
+		{"persistent", &TrieConfig{Persistent: true}},
+		{"index", &TrieConfig{ReverseIndex: true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			exp := New(test.config)
+			for i, e := range randEntries(500) {
+				// Make some leafs store items in btree.
+				exp.Insert(e.Path, e.Item+uint(i%20)*1000)
+			}
+			exp.Insert(Path{}, 42)
+
+			data, err := exp.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			act := New(test.config)
+			act.Insert(PathFromMapStr(map[uint]string{1: "x"}), 1)
+			if err := act.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+
+			if a, b := trieShape(act), trieShape(exp); !reflect.DeepEqual(a, b) {
+				t.Errorf("unmarshaled trie shape = %v; want %v", a, b)
+			}
+			al, an := act.SizeOf(Path{})
+			bl, bn := exp.SizeOf(Path{})
+			if al != bl || an != bn {
+				t.Errorf("SizeOf() = %d, %d; want %d, %d", al, an, bl, bn)
+			}
+			if test.config != nil && test.config.ReverseIndex {
+				for v := uint(0); v < 10; v++ {
+					if a, b := pathStrings(act.PathsOf(v)), pathStrings(exp.PathsOf(v)); !reflect.DeepEqual(a, b) {
+						t.Errorf("PathsOf(%d) = %v; want %v", v, a, b)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTrieMarshalBinaryConcurrent(t *testing.T) {
+	trie := New(nil)
+	entries := randEntries(100)
+	for _, e := range entries {
+		trie.Insert(e.Path, e.Item)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			e := entries[i%len(entries)]
+			if i%2 == 0 {
+				trie.Delete(e.Path, e.Item)
+			} else {
+				trie.Insert(e.Path, e.Item)
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// Encoding must not block mutations and must be readable even if
+		// some of them are written partially.
+		data, err := trie.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := New(nil).UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEncoderPayload(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		tries []*Trie
+	)
+	enc := NewEncoder(&buf)
+	enc.EncodePayload = func(p any) ([]byte, error) {
+		return []byte(strconv.Itoa(p.(int))), nil
+	}
+	for i := 0; i < 3; i++ {
+		trie := New(nil)
+		for _, e := range randEntries(50) {
+			trie.InsertWithPayload(e.Path, e.Item, e.Payload)
+		}
+		if err := enc.Encode(trie); err != nil {
+			t.Fatal(err)
+		}
+		tries = append(tries, trie)
+	}
+
+	dec := NewDecoder(&buf)
+	dec.DecodePayload = func(p []byte) (any, error) {
+		return strconv.Atoi(string(p))
+	}
+	for i := 0; ; i++ {
+		trie := New(nil)
+		err := dec.Decode(trie)
+		if err == io.EOF {
+			if i != len(tries) {
+				t.Fatalf("decoded %d tries; want %d", i, len(tries))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, b := triePayloads(trie), triePayloads(tries[i]); !reflect.DeepEqual(a, b) {
+			t.Errorf("decoded trie #%d payloads = %v; want %v", i, a, b)
+		}
+	}
+
+	trie := New(nil)
+	trie.InsertWithPayload(Path{}, 1, "payload")
+	if _, err := trie.MarshalBinary(); err == nil {
+		t.Errorf("MarshalBinary() of trie with payloads: no error")
+	}
+}
+
+func TestTrieUnmarshalBinaryCorrupted(t *testing.T) {
+	trie := New(nil)
+	for _, e := range randEntries(50) {
+		trie.Insert(e.Path, e.Item)
+	}
+	data, err := trie.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		data func([]byte) []byte
+		err  error
+	}{
+		{
+			name: "empty",
+			data: func([]byte) []byte { return nil },
+			err:  ErrInvalidFormat,
+		},
+		{
+			name: "magic",
+			data: func(p []byte) []byte { p[0] = 'X'; return p },
+			err:  ErrInvalidFormat,
+		},
+		{
+			name: "version",
+			data: func(p []byte) []byte { p[4] = 100; return p },
+			err:  ErrInvalidFormat,
+		},
+		{
+			name: "truncated",
+			data: func(p []byte) []byte { return p[:len(p)/2] },
+			err:  ErrInvalidFormat,
+		},
+		{
+			name: "trailing",
+			data: func(p []byte) []byte { return append(p, 0) },
+			err:  ErrInvalidFormat,
+		},
+		{
+			name: "checksum",
+			data: func(p []byte) []byte { p[len(p)-1]++; return p },
+			err:  ErrChecksum,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			act := New(nil)
+			act.Insert(Path{}, 1)
+			err := act.UnmarshalBinary(test.data(bytes.Clone(data)))
+			if !errors.Is(err, test.err) {
+				t.Errorf("UnmarshalBinary() error = %v; want %v", err, test.err)
+			}
+			if n := act.ItemCount(Path{}); n != 1 {
+				t.Errorf("trie was changed after UnmarshalBinary() error")
+			}
+		})
+	}
+
+	// Any single byte corruption must be detected.
+	for i := range data {
+		p := bytes.Clone(data)
+		p[i] ^= 0x10
+		if err := New(nil).UnmarshalBinary(p); err == nil {
+			t.Fatalf("no error for corrupted byte #%d", i)
+		}
+	}
+}
+
+func TestTrieOfMarshalBinary(t *testing.T) {
+	exp := NewOrdered[int](nil)
+	for i := -100; i < 100; i += 7 {
+		exp.Insert(PathFromMapStr(map[uint]string{1: strconv.Itoa(i % 3)}), i)
+	}
+	data, err := exp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	act := NewOrdered[int](nil)
+	if err := act.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	var a, b []int
+	act.ForEach(Path{}, func(_ []PairStr, v int) bool { a = append(a, v); return true })
+	exp.ForEach(Path{}, func(_ []PairStr, v int) bool { b = append(b, v); return true })
+	sort.Ints(a)
+	sort.Ints(b)
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("unmarshaled items = %v; want %v", a, b)
+	}
+
+	if _, err := NewOrdered[string](nil).MarshalBinary(); err == nil {
+		t.Errorf("MarshalBinary() of string items: no error")
+	}
+}
+
+// trieShape returns items of the trie keyed by the trace of leafs, that is,
+// with respect to the order of nodes.
+func trieShape(trie *Trie) map[string][]uint {
+	m := map[string][]uint{}
+	trie.ForEach(Path{}, func(trace []PairStr, v uint) bool {
+		k := fmt.Sprint(trace)
+		m[k] = append(m[k], v)
+		return true
+	})
+	return m
+}
+
+func triePayloads(trie *Trie) map[string]int {
+	m := map[string]int{}
+	trie.Walk(Path{}, VisitorFunc(
+		func(trace []PairStr, l *Leaf) bool {
+			return l.AscendWithPayload(func(v uint, p any) bool {
+				m[fmt.Sprint(trace, v, p)]++
+				return true
+			})
+		},
+		nil,
+	))
+	return m
+}
@@ -0,0 +1,15 @@
+package radix
+
+// PatternCandidates returns stored patterns of the kind evaluated by lookups
+// with query value q.
+func PatternCandidates(kind KeyKind, patterns []string, q string) (ret []string) {
+	m := kind.newMatcher()
+	for _, p := range patterns {
+		m = m.add(p)
+	}
+	m.(*patternIndex).candidates([]byte(q), func(p pattern) bool {
+		ret = append(ret, p.value)
+		return true
+	})
+	return ret
+}
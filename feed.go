@@ -0,0 +1,312 @@
+package radix
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrSlowConsumer is returned by SubscriptionOf.Err() when subscription was
+// disconnected due to the full buffer.
+var ErrSlowConsumer = errors.New("radix: subscriber is too slow")
+
+// EventKind describes kind of trie mutation.
+type EventKind uint8
+
+const (
+	EventInsert EventKind = iota
+	EventDelete
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventInsert:
+		return "insert"
+	case EventDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is an EventOf uint items.
+type Event = EventOf[uint]
+
+// EventOf describes single change of the trie of items of type T.
+type EventOf[T any] struct {
+	// Seq is a sequence number of the event. Events are numbered in order
+	// they are made by the trie starting from one.
+	Seq  uint64
+	Kind EventKind
+
+	// Path is a path of the leaf which item was inserted to or deleted from.
+	Path Path
+	Item T
+
+	// Payload is a payload of inserted item. Note that insert event is sent
+	// even if item was already present, since its payload could be replaced.
+	Payload any
+
+	// Empty reports whether the leaf has no items left after the change.
+	// Note that the leaf still could have child nodes.
+	Empty bool
+}
+
+// SlowConsumerPolicy describes what to do when subscription buffer is full.
+type SlowConsumerPolicy int
+
+const (
+	// SlowConsumerBlock blocks trie mutations until subscriber receives
+	// events.
+	SlowConsumerBlock SlowConsumerPolicy = iota
+
+	// SlowConsumerDropOldest drops the oldest buffered event to make room
+	// for the new one. Subscriber could detect drops by the gaps in event
+	// sequence numbers. See also SubscriptionOf.Dropped().
+	SlowConsumerDropOldest
+
+	// SlowConsumerDisconnect closes subscription. See SubscriptionOf.Err().
+	SlowConsumerDisconnect
+)
+
+const defaultSubscriptionBuffer = 1024
+
+// SubscriptionConfig contains options of trie subscription.
+type SubscriptionConfig struct {
+	// Buffer is a maximum number of events which are sent to subscriber but
+	// are not yet received. Zero means 1024.
+	Buffer int
+
+	// Policy is applied when buffer is full.
+	Policy SlowConsumerPolicy
+}
+
+// Subscription is a SubscriptionOf uint items.
+type Subscription = SubscriptionOf[uint]
+
+// SubscriptionOf is a stream of changes made by the trie of items of type T.
+type SubscriptionOf[T any] struct {
+	feed    *feed[T]
+	policy  SlowConsumerPolicy
+	events  chan EventOf[T]
+	done    chan struct{}
+	once    sync.Once
+	closed  bool // Guarded by feed.gate.
+	err     error
+	dropped atomic.Uint64
+}
+
+// Subscribe starts delivering changes made by trie mutations after Subscribe
+// returns. Changes are delivered in order they are made. Every mutation is
+// delivered at once after it becomes visible to readers.
+//
+// Note that with at least one subscription all trie mutations are
+// serialized. Returned subscription must be closed when it is no longer
+// needed.
+func (t *TrieOf[T]) Subscribe(config *SubscriptionConfig) *SubscriptionOf[T] {
+	var c SubscriptionConfig
+	if config != nil {
+		c = *config
+	}
+	s, _ := t.subscribe(c)
+	return s
+}
+
+// subscribe is like Subscribe, but also returns sequence number of the last
+// change made before subscription.
+func (t *TrieOf[T]) subscribe(c SubscriptionConfig) (*SubscriptionOf[T], uint64) {
+	if c.Buffer <= 0 {
+		c.Buffer = defaultSubscriptionBuffer
+	}
+	s := &SubscriptionOf[T]{
+		feed:   &t.feed,
+		policy: c.Policy,
+		events: make(chan EventOf[T], c.Buffer),
+		done:   make(chan struct{}),
+	}
+	return s, t.feed.subscribe(s)
+}
+
+// Events returns channel of changes. Channel is closed when subscription is
+// closed or disconnected.
+func (s *SubscriptionOf[T]) Events() <-chan EventOf[T] {
+	return s.events
+}
+
+// Close stops delivering changes and closes Events() channel.
+func (s *SubscriptionOf[T]) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.feed.unsubscribe(s)
+	})
+}
+
+// Err returns ErrSlowConsumer if subscription was disconnected due to the
+// SlowConsumerDisconnect policy. It must be called after Events() channel
+// is closed.
+func (s *SubscriptionOf[T]) Err() error {
+	return s.err
+}
+
+// Dropped returns number of events dropped due to the
+// SlowConsumerDropOldest policy.
+func (s *SubscriptionOf[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// send delivers e with respect to the policy. It returns false if
+// subscription must be disconnected.
+func (s *SubscriptionOf[T]) send(e EventOf[T]) bool {
+	select {
+	case s.events <- e:
+		return true
+	default:
+	}
+	switch s.policy {
+	case SlowConsumerBlock:
+		select {
+		case s.events <- e:
+		case <-s.done:
+		}
+	case SlowConsumerDropOldest:
+		select {
+		case <-s.events:
+			s.dropped.Add(1)
+		default:
+		}
+		// Subscriber could only receive events, thus there is a room for e.
+		s.events <- e
+	case SlowConsumerDisconnect:
+		return false
+	}
+	return true
+}
+
+// feed collects changes made by trie mutation and sends them to
+// subscriptions.
+type feed[T any] struct {
+	// gate is held for writing by mutations while there are subscriptions.
+	// Otherwise it is held for reading. That is, changes made by concurrent
+	// mutations are never mixed.
+	gate sync.RWMutex
+	subs []*SubscriptionOf[T]
+	n    atomic.Int32
+
+	// collecting is true if changes must be collected by current mutation.
+	collecting bool
+	events     []EventOf[T]
+	seq        uint64
+}
+
+func (f *feed[T]) begin() {
+	if f.n.Load() == 0 {
+		f.gate.RLock()
+		return
+	}
+	f.gate.Lock()
+	f.collecting = len(f.subs) > 0
+	if !f.collecting {
+		// Last subscription was closed meanwhile.
+		f.gate.Unlock()
+		f.gate.RLock()
+	}
+}
+
+func (f *feed[T]) end() {
+	if !f.collecting {
+		f.gate.RUnlock()
+		return
+	}
+	defer f.gate.Unlock()
+	f.collecting = false
+
+	subs := f.subs[:0]
+	for _, s := range f.subs {
+		ok := true
+		for _, e := range f.events {
+			if ok = s.send(e); !ok {
+				break
+			}
+		}
+		if ok {
+			subs = append(subs, s)
+			continue
+		}
+		s.err = ErrSlowConsumer
+		s.closed = true
+		close(s.events)
+	}
+	clear(f.subs[len(subs):])
+	f.subs = subs
+	f.n.Store(int32(len(subs)))
+
+	clear(f.events)
+	f.events = f.events[:0]
+}
+
+func (f *feed[T]) add(kind EventKind, p Path, v T, payload any, empty bool) {
+	f.seq++
+	f.events = append(f.events, EventOf[T]{
+		Seq:     f.seq,
+		Kind:    kind,
+		Path:    clonePath(p),
+		Item:    v,
+		Payload: payload,
+		Empty:   empty,
+	})
+}
+
+// replace adds changes made by replacement of the tree starting at prev with
+// the tree starting at next.
+func (f *feed[T]) replace(prev, next *LeafOf[T]) {
+	Dig(prev, leafVisitor[T](func(trace []PairStr, leaf *LeafOf[T]) bool {
+		var (
+			p = PathFromSliceStr(trace)
+			n = leaf.ItemCount()
+			i int
+		)
+		leaf.Ascend(func(v T) bool {
+			i++
+			f.add(EventDelete, p, v, nil, i == n)
+			return true
+		})
+		return true
+	}))
+	Dig(next, leafVisitor[T](func(trace []PairStr, leaf *LeafOf[T]) bool {
+		p := PathFromSliceStr(trace)
+		leaf.AscendWithPayload(func(v T, payload any) bool {
+			f.add(EventInsert, p, v, payload, false)
+			return true
+		})
+		return true
+	}))
+}
+
+// subscribe adds s to the feed. It returns sequence number of the last
+// change made before s was added.
+func (f *feed[T]) subscribe(s *SubscriptionOf[T]) (seq uint64) {
+	f.gate.Lock()
+	defer f.gate.Unlock()
+	f.subs = append(f.subs, s)
+	f.n.Store(int32(len(f.subs)))
+	return f.seq
+}
+
+func (f *feed[T]) unsubscribe(s *SubscriptionOf[T]) {
+	// Mutation blocked by s is released by closed s.done.
+	f.gate.Lock()
+	defer f.gate.Unlock()
+	if s.closed {
+		return
+	}
+	for i, x := range f.subs {
+		if x == s {
+			f.subs = slices.Delete(f.subs, i, i+1)
+			break
+		}
+	}
+	f.n.Store(int32(len(f.subs)))
+	s.closed = true
+	close(s.events)
+}
@@ -0,0 +1,146 @@
+package radix_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	. "github.com/gobwas/radix"
+)
+
+func TestTrieSubscribe(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config *TrieConfig
+	}{
+		{"default", nil},
+		{"persistent", &TrieConfig{Persistent: true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			trie := New(test.config)
+			a := PathFromMapStr(map[uint]string{1: "a"})
+			b := PathFromMapStr(map[uint]string{1: "b"})
+			trie.Insert(a, 1)
+
+			sub := trie.Subscribe(nil)
+			trie.Insert(a, 2)
+			trie.InsertWithPayload(a, 2, "x") // Payload is replaced.
+			trie.Move(a, b, 1)
+			trie.Delete(a, 2)
+			x := trie.Txn()
+			x.Insert(a, 3)
+			x.Delete(b, 1)
+			x.Commit()
+			sub.Close()
+
+			var act []string
+			for e := range sub.Events() {
+				act = append(act, fmt.Sprint(e.Seq, e.Kind, e.Path, e.Item, e.Payload, e.Empty))
+			}
+			exp := []string{
+				fmt.Sprint(1, EventInsert, a, 2, nil, false),
+				fmt.Sprint(2, EventInsert, a, 2, "x", false),
+				fmt.Sprint(3, EventDelete, a, 1, nil, false),
+				fmt.Sprint(4, EventInsert, b, 1, nil, false),
+				fmt.Sprint(5, EventDelete, a, 2, nil, true),
+				fmt.Sprint(6, EventInsert, a, 3, nil, false),
+				fmt.Sprint(7, EventDelete, b, 1, nil, true),
+			}
+			if !reflect.DeepEqual(act, exp) {
+				t.Errorf("events:\n%q\nwant:\n%q", act, exp)
+			}
+			if err := sub.Err(); err != nil {
+				t.Errorf("Err() = %v; want nil", err)
+			}
+		})
+	}
+}
+
+func TestTrieSubscribePolicy(t *testing.T) {
+	p := PathFromMapStr(map[uint]string{1: "a"})
+	for _, test := range []struct {
+		name    string
+		policy  SlowConsumerPolicy
+		seq     []uint64
+		dropped uint64
+		err     error
+	}{
+		{
+			name:    "drop oldest",
+			policy:  SlowConsumerDropOldest,
+			seq:     []uint64{4, 5},
+			dropped: 3,
+		},
+		{
+			name:   "disconnect",
+			policy: SlowConsumerDisconnect,
+			seq:    []uint64{1, 2},
+			err:    ErrSlowConsumer,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			trie := New(nil)
+			sub := trie.Subscribe(&SubscriptionConfig{
+				Buffer: 2,
+				Policy: test.policy,
+			})
+			for i := uint(0); i < 5; i++ {
+				trie.Insert(p, i)
+			}
+			sub.Close()
+
+			var seq []uint64
+			for e := range sub.Events() {
+				seq = append(seq, e.Seq)
+			}
+			if !reflect.DeepEqual(seq, test.seq) {
+				t.Errorf("received events = %v; want %v", seq, test.seq)
+			}
+			if n := sub.Dropped(); n != test.dropped {
+				t.Errorf("Dropped() = %d; want %d", n, test.dropped)
+			}
+			if err := sub.Err(); !errors.Is(err, test.err) {
+				t.Errorf("Err() = %v; want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestTrieSubscribeConcurrent(t *testing.T) {
+	const (
+		writers = 8
+		inserts = 100
+	)
+	trie := New(nil)
+	sub := trie.Subscribe(&SubscriptionConfig{
+		Buffer: 1,
+		Policy: SlowConsumerBlock,
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < inserts; j++ {
+				trie.Insert(PathFromMapStr(map[uint]string{1: fmt.Sprint(i)}), uint(j))
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		sub.Close()
+	}()
+
+	var n uint64
+	for e := range sub.Events() {
+		n++
+		if e.Seq != n {
+			t.Fatalf("unexpected event sequence number: %d; want %d", e.Seq, n)
+		}
+	}
+	if n != writers*inserts {
+		t.Errorf("received %d events; want %d", n, writers*inserts)
+	}
+}
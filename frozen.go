@@ -0,0 +1,423 @@
+package radix
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Frozen trie layout is as follows. All numbers are 64-bit little endian
+// unsigned integers; every record is aligned to 8 bytes.
+//
+//	file  = magic version *(leaf / node / value) root
+//	leaf  = count(items) count(nodes) *item *(key offset(node))
+//	node  = count(leafs) flags *(offset(value) len(value) offset(leaf))
+//	value = bytes padded with zeroes
+//
+// Records are written bottom-up, so offsets always refer to preceding data.
+// Items are sorted; nodes are sorted by key; leafs are sorted by value. Node
+// flags are made of frozenNode* bits.
+const (
+	frozenMagic   = "RDXF"
+	frozenVersion = 1
+
+	// frozenNodeAny is set if leaf with Any value of the node matches any
+	// query value.
+	frozenNodeAny = 1 << 0
+
+	frozenHeaderSize = 8
+	frozenFooterSize = 8
+)
+
+// ErrFrozenFormat is returned when data is not a frozen trie.
+var ErrFrozenFormat = errors.New("radix: invalid frozen trie format")
+
+// WriteFrozen writes frozen representation of t to w. It could be opened
+// later by OpenFrozen or NewFrozen. Note that payloads are not written.
+//
+// Frozen format holds only uint items, thus there is no generic version of
+// WriteFrozen and FrozenTrie. Map items to uint identifiers to freeze a TrieOf
+// other items.
+//
+// WriteFrozen reads t as lookups do, without blocking them or mutations. Note
+// that for non-persistent trie mutations made concurrently with WriteFrozen
+// could be written partially; write t.Snapshot() if consistent state is
+// needed.
+func WriteFrozen(w io.Writer, t *Trie) error {
+	fw := frozenWriter{
+		w: bufio.NewWriter(w),
+	}
+	fw.buf = append(fw.buf, frozenMagic...)
+	fw.buf = binary.LittleEndian.AppendUint32(fw.buf, frozenVersion)
+	fw.write()
+
+	root := fw.leaf(t.root.Load())
+	fw.buf = binary.LittleEndian.AppendUint64(fw.buf, root)
+	fw.write()
+
+	if fw.err != nil {
+		return fw.err
+	}
+	return fw.w.Flush()
+}
+
+type frozenWriter struct {
+	w   *bufio.Writer
+	buf []byte
+	off uint64
+	err error
+}
+
+// write writes buffered data and returns its offset.
+func (w *frozenWriter) write() (off uint64) {
+	if pad := len(w.buf) % 8; pad != 0 {
+		w.buf = append(w.buf, make([]byte, 8-pad)...)
+	}
+	if w.err == nil {
+		_, w.err = w.w.Write(w.buf)
+	}
+	off = w.off
+	w.off += uint64(len(w.buf))
+	w.buf = w.buf[:0]
+	return off
+}
+
+func (w *frozenWriter) leaf(l *Leaf) uint64 {
+	type child struct {
+		key uint
+		off uint64
+	}
+	var children []child
+	l.AscendChildren(func(n *Node) bool {
+		children = append(children, child{n.key, w.node(n)})
+		return true
+	})
+
+	items := l.AppendTo(nil)
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, uint64(len(items)))
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, uint64(len(children)))
+	for _, v := range items {
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, uint64(v))
+	}
+	for _, c := range children {
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, uint64(c.key))
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, c.off)
+	}
+	return w.write()
+}
+
+func (w *frozenWriter) node(n *Node) uint64 {
+	var (
+		values []string
+		leafs  []*Leaf
+	)
+	n.AscendLeafs(func(v string, l *Leaf) bool {
+		values = append(values, v)
+		leafs = append(leafs, l)
+		return true
+	})
+
+	type entry struct {
+		value uint64
+		leaf  uint64
+	}
+	entries := make([]entry, len(values))
+	for i, v := range values {
+		entries[i].leaf = w.leaf(leafs[i])
+		w.buf = append(w.buf, v...)
+		entries[i].value = w.write()
+	}
+
+	var flags uint64
+	if n.kinds.matchesAny(n.key) {
+		flags |= frozenNodeAny
+	}
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, uint64(len(values)))
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, flags)
+	for i, e := range entries {
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, e.value)
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, uint64(len(values[i])))
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, e.leaf)
+	}
+	return w.write()
+}
+
+// FrozenTrie is a read-only trie of uint items which is queried directly
+// from its frozen representation, without making any Leaf or Node objects.
+// Opened by OpenFrozen, it shares memory pages with every other process which
+// opened the same file.
+//
+// Only headers are validated when FrozenTrie is opened. Queries panic if the
+// data is corrupted.
+//
+// FrozenTrie is safe for concurrent use.
+type FrozenTrie struct {
+	data  []byte
+	root  uint64
+	close func() error
+}
+
+// NewFrozen returns FrozenTrie which is read from data written by
+// WriteFrozen. Data must not be changed while FrozenTrie is used.
+func NewFrozen(data []byte) (*FrozenTrie, error) {
+	if len(data) < frozenHeaderSize+frozenFooterSize || len(data)%8 != 0 {
+		return nil, fmt.Errorf("%w: bad size %d", ErrFrozenFormat, len(data))
+	}
+	if string(data[:len(frozenMagic)]) != frozenMagic {
+		return nil, fmt.Errorf("%w: bad magic %q", ErrFrozenFormat, data[:len(frozenMagic)])
+	}
+	if v := binary.LittleEndian.Uint32(data[len(frozenMagic):]); v != frozenVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrFrozenFormat, v)
+	}
+	f := &FrozenTrie{
+		data: data,
+		root: binary.LittleEndian.Uint64(data[len(data)-frozenFooterSize:]),
+	}
+	if f.root < frozenHeaderSize || f.root >= uint64(len(data)-frozenFooterSize) {
+		return nil, fmt.Errorf("%w: bad root offset %d", ErrFrozenFormat, f.root)
+	}
+	return f, nil
+}
+
+// Close releases resources used by f. FrozenTrie must not be used after
+// Close.
+func (f *FrozenTrie) Close() error {
+	if f.close == nil {
+		return nil
+	}
+	err := f.close()
+	f.close = nil
+	f.data = nil
+	return err
+}
+
+// LookupStrict is like TrieOf.LookupStrict.
+func (f *FrozenTrie) LookupStrict(query Path, it Iterator) {
+	f.lookup(f.root, query, LookupStrategyStrict, false, func(leaf uint64) bool {
+		return f.ascend(leaf, it)
+	})
+}
+
+// LookupGreedy is like TrieOf.LookupGreedy.
+func (f *FrozenTrie) LookupGreedy(query Path, it Iterator) {
+	f.lookup(f.root, query, LookupStrategyGreedy, false, func(leaf uint64) bool {
+		return f.ascend(leaf, it)
+	})
+}
+
+// SelectStrict is like TrieOf.SelectStrict.
+func (f *FrozenTrie) SelectStrict(query Path, wildcard Wildcard, it PathIterator) {
+	f.capture(f.root, query, wildcard, LookupStrategyStrict, func(w Wildcard, leaf uint64) bool {
+		return f.ascend(leaf, func(v uint) bool {
+			return it(w, v)
+		})
+	})
+}
+
+// SelectGreedy is like TrieOf.SelectGreedy.
+func (f *FrozenTrie) SelectGreedy(query Path, wildcard Wildcard, it PathIterator) {
+	f.capture(f.root, query, wildcard, LookupStrategyGreedy, func(w Wildcard, leaf uint64) bool {
+		return f.ascend(leaf, func(v uint) bool {
+			return it(w, v)
+		})
+	})
+}
+
+// ForEach is like TrieOf.ForEach.
+func (f *FrozenTrie) ForEach(query Path, it TraceIterator) {
+	f.lookup(f.root, query, LookupStrategyStrict, true, func(leaf uint64) bool {
+		return f.dig(leaf, nil, func(trace []PairStr, leaf uint64) bool {
+			return f.ascend(leaf, func(v uint) bool {
+				return it(trace, v)
+			})
+		})
+	})
+}
+
+// lookup is like lookup().
+func (f *FrozenTrie) lookup(leaf uint64, query Path, s LookupStrategy, exact bool, it func(uint64) bool) bool {
+	switch s {
+	case LookupStrategyStrict:
+		if query.Len() == 0 {
+			return it(leaf)
+		}
+	case LookupStrategyGreedy:
+		if !it(leaf) {
+			return false
+		}
+	}
+	if query.Len() == 0 {
+		return true
+	}
+	min, max := query.KeyRange()
+	return f.ascendNodes(leaf, min, max, func(key uint, node uint64) bool {
+		v, ok := query.Get(key)
+		if !ok {
+			return true
+		}
+		if exact {
+			if child, ok := f.leaf(node, v); ok {
+				return f.lookup(child, query.Without(key), s, exact, it)
+			}
+			return true
+		}
+		return f.match(node, v, func(child uint64) bool {
+			return f.lookup(child, query.Without(key), s, exact, it)
+		})
+	})
+}
+
+// capture is like capture() in greedy mode, that is, as Select does.
+func (f *FrozenTrie) capture(leaf uint64, query Path, wildcard Wildcard, s LookupStrategy, it func(Wildcard, uint64) bool) bool {
+	switch s {
+	case LookupStrategyStrict:
+		if query.Len() == 0 {
+			return it(wildcard, leaf)
+		}
+	case LookupStrategyGreedy:
+		if !it(wildcard, leaf) {
+			return false
+		}
+	}
+	return f.ascendNodes(leaf, 0, ^uint(0), func(key uint, node uint64) bool {
+		if v, ok := query.Get(key); ok {
+			return f.match(node, v, func(child uint64) bool {
+				return f.capture(child, query.Without(key), wildcard, s, it)
+			})
+		}
+		prev, has := wildcard[key]
+		r := f.ascendLeafs(node, func(v []byte, child uint64) bool {
+			if has {
+				wildcard[key] = string(v)
+			}
+			return f.capture(child, query, wildcard, s, it)
+		})
+		if has {
+			wildcard[key] = prev
+		}
+		return r
+	})
+}
+
+// match is like NodeOf.AscendMatch.
+func (f *FrozenTrie) match(node uint64, v []byte, it func(uint64) bool) bool {
+	child, ok := f.leaf(node, v)
+	if ok && !it(child) {
+		return false
+	}
+	if string(v) == Any || f.u64(node+8)&frozenNodeAny == 0 {
+		return true
+	}
+	if child, ok := f.leaf(node, []byte(Any)); ok {
+		return it(child)
+	}
+	return true
+}
+
+func (f *FrozenTrie) dig(leaf uint64, trace []PairStr, it func([]PairStr, uint64) bool) bool {
+	if !it(trace, leaf) {
+		return false
+	}
+	return f.ascendNodes(leaf, 0, ^uint(0), func(key uint, node uint64) bool {
+		return f.ascendLeafs(node, func(v []byte, child uint64) bool {
+			return f.dig(child, append(trace, PairStr{key, string(v)}), it)
+		})
+	})
+}
+
+func (f *FrozenTrie) ascend(leaf uint64, it Iterator) bool {
+	n := f.u64(leaf)
+	for i := uint64(0); i < n; i++ {
+		if !it(uint(f.u64(leaf + 16 + i*8))) {
+			return false
+		}
+	}
+	return true
+}
+
+// ascendNodes calls it for every node of the leaf with key in [min, max].
+func (f *FrozenTrie) ascendNodes(leaf uint64, min, max uint, it func(uint, uint64) bool) bool {
+	var (
+		items = f.u64(leaf)
+		n     = f.u64(leaf + 8)
+		base  = leaf + 16 + items*8
+	)
+	key := func(i uint64) uint {
+		return uint(f.u64(base + i*16))
+	}
+	// Find the first node with key not less than min.
+	l, r := uint64(0), n
+	for l < r {
+		m := l + (r-l)/2
+		if key(m) < min {
+			l = m + 1
+		} else {
+			r = m
+		}
+	}
+	for i := l; i < n; i++ {
+		k := key(i)
+		if k > max {
+			break
+		}
+		if !it(k, f.below(f.u64(base+i*16+8), leaf)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *FrozenTrie) ascendLeafs(node uint64, it func([]byte, uint64) bool) bool {
+	n := f.u64(node)
+	for i := uint64(0); i < n; i++ {
+		e := node + 16 + i*24
+		if !it(f.bytes(f.u64(e), f.u64(e+8)), f.below(f.u64(e+16), node)) {
+			return false
+		}
+	}
+	return true
+}
+
+// leaf returns offset of the node's leaf with value v.
+func (f *FrozenTrie) leaf(node uint64, v []byte) (uint64, bool) {
+	l, r := uint64(0), f.u64(node)
+	for l < r {
+		m := l + (r-l)/2
+		e := node + 16 + m*24
+		switch c := bytes.Compare(f.bytes(f.u64(e), f.u64(e+8)), v); {
+		case c == 0:
+			return f.below(f.u64(e+16), node), true
+		case c < 0:
+			l = m + 1
+		default:
+			r = m
+		}
+	}
+	return 0, false
+}
+
+// below checks that record at offset off is written before the record at
+// offset parent. It prevents infinite loops on corrupted data.
+func (f *FrozenTrie) below(off, parent uint64) uint64 {
+	if off >= parent {
+		panic("radix: frozen trie is corrupted")
+	}
+	return off
+}
+
+func (f *FrozenTrie) u64(off uint64) uint64 {
+	if off > uint64(len(f.data))-8 {
+		panic("radix: frozen trie is corrupted")
+	}
+	return binary.LittleEndian.Uint64(f.data[off:])
+}
+
+func (f *FrozenTrie) bytes(off, n uint64) []byte {
+	if off > uint64(len(f.data)) || n > uint64(len(f.data))-off {
+		panic("radix: frozen trie is corrupted")
+	}
+	return f.data[off : off+n : off+n]
+}
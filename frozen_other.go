@@ -0,0 +1,18 @@
+//go:build !unix
+
+package radix
+
+import "os"
+
+// OpenFrozen reads file written by WriteFrozen and returns FrozenTrie
+// reading from it.
+//
+// Note that on this platform the file is read into memory instead of being
+// mapped.
+func OpenFrozen(name string) (*FrozenTrie, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewFrozen(data)
+}
@@ -0,0 +1,151 @@
+package radix_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	. "github.com/gobwas/radix"
+)
+
+func TestFrozenTrie(t *testing.T) {
+	// Any is a literal value of keys not listed in AnyKeys.
+	trie := New(&TrieConfig{NodeOrder: []uint{2}, AnyKeys: []uint{0, 1, 2}})
+	entries := randEntries(300)
+	for i, e := range entries {
+		trie.Insert(e.Path, e.Item)
+		if i%10 == 0 && e.Path.Len() > 0 {
+			// Replace one of the values with Any.
+			m := map[uint]string{}
+			e.Path.Ascend(e.Path.Begin(), func(p Pair) bool {
+				m[p.Key] = string(p.Value)
+				return true
+			})
+			k, _ := e.Path.FirstKey()
+			m[k] = Any
+			trie.Insert(PathFromMapStr(m), e.Item)
+		}
+	}
+
+	name := filepath.Join(t.TempDir(), "trie")
+	file, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFrozen(file, trie); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	frozen, err := OpenFrozen(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frozen.Close()
+
+	queries := []Path{{}}
+	for _, e := range entries {
+		queries = append(queries, e.Path)
+	}
+	for _, q := range queries {
+		for _, test := range []struct {
+			name string
+			trie func(Path, func(string))
+			frzn func(Path, func(string))
+		}{
+			{
+				name: "LookupStrict",
+				trie: func(q Path, cb func(string)) {
+					trie.LookupStrict(q, func(v uint) bool { cb(fmt.Sprint(v)); return true })
+				},
+				frzn: func(q Path, cb func(string)) {
+					frozen.LookupStrict(q, func(v uint) bool { cb(fmt.Sprint(v)); return true })
+				},
+			},
+			{
+				name: "LookupGreedy",
+				trie: func(q Path, cb func(string)) {
+					trie.LookupGreedy(q, func(v uint) bool { cb(fmt.Sprint(v)); return true })
+				},
+				frzn: func(q Path, cb func(string)) {
+					frozen.LookupGreedy(q, func(v uint) bool { cb(fmt.Sprint(v)); return true })
+				},
+			},
+			{
+				name: "SelectStrict",
+				trie: func(q Path, cb func(string)) {
+					trie.SelectStrict(q, NewWildcard(1, 3), func(w Wildcard, v uint) bool {
+						cb(fmt.Sprint(w[1], w[3], v))
+						return true
+					})
+				},
+				frzn: func(q Path, cb func(string)) {
+					frozen.SelectStrict(q, NewWildcard(1, 3), func(w Wildcard, v uint) bool {
+						cb(fmt.Sprint(w[1], w[3], v))
+						return true
+					})
+				},
+			},
+			{
+				name: "SelectGreedy",
+				trie: func(q Path, cb func(string)) {
+					trie.SelectGreedy(q, NewWildcard(1, 3), func(w Wildcard, v uint) bool {
+						cb(fmt.Sprint(w[1], w[3], v))
+						return true
+					})
+				},
+				frzn: func(q Path, cb func(string)) {
+					frozen.SelectGreedy(q, NewWildcard(1, 3), func(w Wildcard, v uint) bool {
+						cb(fmt.Sprint(w[1], w[3], v))
+						return true
+					})
+				},
+			},
+			{
+				name: "ForEach",
+				trie: func(q Path, cb func(string)) {
+					trie.ForEach(q, func(trace []PairStr, v uint) bool { cb(fmt.Sprint(trace, v)); return true })
+				},
+				frzn: func(q Path, cb func(string)) {
+					frozen.ForEach(q, func(trace []PairStr, v uint) bool { cb(fmt.Sprint(trace, v)); return true })
+				},
+			},
+		} {
+			exp := map[string]int{}
+			test.trie(q, func(s string) { exp[s]++ })
+			act := map[string]int{}
+			test.frzn(q, func(s string) { act[s]++ })
+			if !reflect.DeepEqual(act, exp) {
+				t.Fatalf("frozen %s(%v) = %v; want %v", test.name, q, act, exp)
+			}
+		}
+	}
+}
+
+func TestNewFrozenInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrozen(&buf, New(nil)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	for _, test := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", data[:len(data)-8]},
+		{"magic", append([]byte("XXXX"), data[4:]...)},
+		{"root", append(bytes.Clone(data[:len(data)-8]), 0xff, 0, 0, 0, 0, 0, 0, 0)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewFrozen(test.data); !errors.Is(err, ErrFrozenFormat) {
+				t.Errorf("NewFrozen() error = %v; want %v", err, ErrFrozenFormat)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package radix
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// OpenFrozen maps file written by WriteFrozen into memory and returns
+// FrozenTrie reading from it. Pages of the file are shared between all
+// processes which opened it.
+func OpenFrozen(name string) (*FrozenTrie, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size <= 0 || int64(int(size)) != size {
+		return nil, fmt.Errorf("%w: bad size %d", ErrFrozenFormat, size)
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("radix: mmap %s: %w", name, err)
+	}
+	f, err := NewFrozen(data)
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, err
+	}
+	f.close = func() error {
+		return syscall.Munmap(data)
+	}
+	return f, nil
+}
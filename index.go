@@ -0,0 +1,158 @@
+package radix
+
+import (
+	"sync"
+
+	"github.com/google/btree"
+)
+
+// reverseIndex holds paths of leafs where every item of a trie is stored.
+//
+// Its mutex is held by the trie during every indexed mutation, so the index
+// and the leafs contents are changed together.
+type reverseIndex[T any] struct {
+	mu    sync.RWMutex
+	items *btree.BTreeG[indexEntry[T]]
+}
+
+type indexEntry[T any] struct {
+	item  T
+	paths []indexPath
+}
+
+type indexPath struct {
+	key  string
+	path Path
+}
+
+func newReverseIndex[T any](compare func(a, b T) int) *reverseIndex[T] {
+	return &reverseIndex[T]{
+		items: btree.NewG(degree, func(a, b indexEntry[T]) bool {
+			return compare(a.item, b.item) < 0
+		}),
+	}
+}
+
+// add marks leaf at path p as containing v.
+// Caller must hold x.mu.
+func (x *reverseIndex[T]) add(v T, p Path) {
+	k := pathKey(p)
+	e, _ := x.items.Get(indexEntry[T]{item: v})
+	for _, ip := range e.paths {
+		if ip.key == k {
+			return
+		}
+	}
+	// Entries are never changed in place since they could be shared with the
+	// index clones.
+	paths := make([]indexPath, 0, len(e.paths)+1)
+	paths = append(paths, e.paths...)
+	paths = append(paths, indexPath{k, clonePath(p)})
+	e.item = v
+	e.paths = paths
+	x.items.ReplaceOrInsert(e)
+}
+
+// addTree marks every leaf of the tree starting at root as containing its
+// items.
+// Caller must hold x.mu.
+func (x *reverseIndex[T]) addTree(root *LeafOf[T]) {
+	Dig(root, leafVisitor[T](func(trace []PairStr, leaf *LeafOf[T]) bool {
+		p := PathFromSliceStr(trace)
+		leaf.Ascend(func(v T) bool {
+			x.add(v, p)
+			return true
+		})
+		return true
+	}))
+}
+
+// remove marks leaf at path p as not containing v anymore.
+// Caller must hold x.mu.
+func (x *reverseIndex[T]) remove(v T, p Path) {
+	e, ok := x.items.Get(indexEntry[T]{item: v})
+	if !ok {
+		return
+	}
+	k := pathKey(p)
+	for i, ip := range e.paths {
+		if ip.key != k {
+			continue
+		}
+		n := len(e.paths) - 1
+		if n == 0 {
+			x.items.Delete(e)
+			return
+		}
+		paths := make([]indexPath, 0, n)
+		paths = append(paths, e.paths[:i]...)
+		paths = append(paths, e.paths[i+1:]...)
+		e.paths = paths
+		x.items.ReplaceOrInsert(e)
+		return
+	}
+}
+
+// paths returns paths of leafs containing v.
+// Caller must hold x.mu for reading. Returned slice must not be modified.
+func (x *reverseIndex[T]) paths(v T) []indexPath {
+	e, _ := x.items.Get(indexEntry[T]{item: v})
+	return e.paths
+}
+
+// drop removes v from the index and returns paths of leafs that contained it.
+// Caller must hold x.mu.
+func (x *reverseIndex[T]) drop(v T) []indexPath {
+	e, _ := x.items.Delete(indexEntry[T]{item: v})
+	return e.paths
+}
+
+// clone returns copy of the index. Copy shares the structure with x until one
+// of them is changed.
+// Caller must hold x.mu.
+func (x *reverseIndex[T]) clone() *reverseIndex[T] {
+	return &reverseIndex[T]{
+		items: x.items.Clone(),
+	}
+}
+
+// PathsOf returns paths of every leaf where v is stored.
+// It panics if trie was created without TrieConfig.ReverseIndex option.
+func (t *TrieOf[T]) PathsOf(v T) []Path {
+	x := t.mustIndex()
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	paths := x.paths(v)
+	if len(paths) == 0 {
+		return nil
+	}
+	ret := make([]Path, len(paths))
+	for i, ip := range paths {
+		ret[i] = clonePath(ip.path)
+	}
+	return ret
+}
+
+// DeleteItem removes v from every leaf it is stored in.
+// It returns true if v was present at least in one leaf.
+// It panics if trie was created without TrieConfig.ReverseIndex option.
+func (t *TrieOf[T]) DeleteItem(v T) (ok bool) {
+	x := t.mustIndex()
+	t.beginWrite(false)
+	defer t.endWrite(false)
+
+	for _, ip := range x.drop(v) {
+		if _, removed := t.deleteFrom(nil, ip.path, v); removed {
+			ok = true
+		}
+	}
+	return ok
+}
+
+func (t *TrieOf[T]) mustIndex() *reverseIndex[T] {
+	if t.index == nil {
+		panic("radix: reverse index is not enabled")
+	}
+	return t.index
+}
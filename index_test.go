@@ -0,0 +1,119 @@
+package radix_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	. "github.com/gobwas/radix"
+)
+
+func TestTriePathsOf(t *testing.T) {
+	trie := New(&TrieConfig{
+		NodeOrder:    []uint{2},
+		ReverseIndex: true,
+	})
+	for _, op := range []item{
+		{pairs{{1, "a"}, {2, "b"}}, 1},
+		{pairs{{1, "a"}}, 1},
+		{pairs{{3, "c"}}, 1},
+		{pairs{{3, "c"}}, 2},
+		{pairs{}, 1},
+	} {
+		trie.Insert(PathFromSliceStr(op.p), op.v)
+	}
+
+	act := pathStrings(trie.PathsOf(1))
+	exp := pathStrings([]Path{
+		PathFromSliceStr(pairs{{1, "a"}, {2, "b"}}),
+		PathFromSliceStr(pairs{{1, "a"}}),
+		PathFromSliceStr(pairs{{3, "c"}}),
+		PathFromSliceStr(pairs{}),
+	})
+	if !reflect.DeepEqual(act, exp) {
+		t.Errorf("PathsOf(1) = %v; want %v", act, exp)
+	}
+
+	if !trie.Delete(PathFromSliceStr(pairs{{1, "a"}}), 1) {
+		t.Fatalf("Delete() = false; want true")
+	}
+	if n := len(trie.PathsOf(1)); n != 3 {
+		t.Errorf("PathsOf(1) after Delete() returned %d paths; want 3", n)
+	}
+
+	if !trie.DeleteItem(1) {
+		t.Fatalf("DeleteItem(1) = false; want true")
+	}
+	if trie.DeleteItem(1) {
+		t.Fatalf("repeated DeleteItem(1) = true; want false")
+	}
+	if ps := trie.PathsOf(1); ps != nil {
+		t.Errorf("PathsOf(1) after DeleteItem() = %v; want nil", ps)
+	}
+	if leafs, nodes := trie.SizeOf(Path{}); leafs != 1 || nodes != 1 {
+		t.Errorf("SizeOf() after DeleteItem() = %d, %d; want 1, 1", leafs, nodes)
+	}
+}
+
+func TestTrieReverseIndexConcurrent(t *testing.T) {
+	trie := New(&TrieConfig{
+		ReverseIndex: true,
+	})
+	paths := make([]Path, 8)
+	for i := range paths {
+		paths[i] = PathFromMapStr(map[uint]string{
+			uint(i % 3):    "x",
+			uint(i%2) + 10: fmt.Sprintf("%d", i),
+		})
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				v := uint(i % 10)
+				p := paths[(w+i)%len(paths)]
+				switch i % 3 {
+				case 0, 1:
+					trie.Insert(p, v)
+				case 2:
+					if i%5 == 0 {
+						trie.DeleteItem(v)
+					} else {
+						trie.Delete(p, v)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	stored := map[uint][]string{}
+	trie.ForEach(Path{}, func(trace []PairStr, v uint) bool {
+		stored[v] = append(stored[v], PathFromSliceStr(trace).String())
+		return true
+	})
+	for v := uint(0); v < 10; v++ {
+		exp := stored[v]
+		sort.Strings(exp)
+		if act := pathStrings(trie.PathsOf(v)); !reflect.DeepEqual(act, exp) {
+			t.Errorf("PathsOf(%d) = %v; want %v", v, act, exp)
+		}
+	}
+}
+
+func pathStrings(ps []Path) []string {
+	if len(ps) == 0 {
+		return nil
+	}
+	ret := make([]string, len(ps))
+	for i, p := range ps {
+		ret[i] = p.String()
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,233 @@
+package radix
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// Range is a KeyKind of numeric intervals, like "price between 10 and 100" or
+// "version >= 3.2".
+//
+// Stored values are closed intervals made by RangeValue or single numbers.
+// Query values are numbers in the format accepted by strconv.ParseFloat.
+// Stored interval matches query value if it contains it or if it is equal to
+// it, e.g. query with RangeValue(10, 100) finds the stored one. Stored values
+// which are not valid intervals are matched by equality.
+type Range struct{}
+
+func (Range) newMatcher() matcher {
+	return new(intervalIndex)
+}
+
+// RangeValue returns value of Range key holding closed interval [lo, hi].
+// Use math.Inf to make open-ended intervals.
+func RangeValue(lo, hi float64) string {
+	return formatFloat(lo) + ".." + formatFloat(hi)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// parseRange parses value of Range key.
+func parseRange(v string) (lo, hi float64, ok bool) {
+	a, b, isRange := strings.Cut(v, "..")
+	if !isRange {
+		b = a
+	}
+	lo, err := strconv.ParseFloat(a, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	hi, err = strconv.ParseFloat(b, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	// Note that comparison is false for NaN.
+	return lo, hi, lo <= hi
+}
+
+// intervalIndex is an interval tree. It is implemented as a treap ordered by
+// intervals' lower bounds and augmented with the maximum of upper bounds of
+// every subtree. Its nodes are copied on write as nodes of treap are.
+type intervalIndex struct {
+	root *intervalNode
+
+	// other holds values which are not valid intervals.
+	other treap[string, struct{}]
+}
+
+type interval struct {
+	lo, hi float64
+	value  string
+}
+
+func compareIntervals(a, b interval) int {
+	if c := cmp.Compare(a.lo, b.lo); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.hi, b.hi); c != 0 {
+		return c
+	}
+	return strings.Compare(a.value, b.value)
+}
+
+type intervalNode struct {
+	interval
+	prio        uint32
+	max         float64
+	left, right *intervalNode
+}
+
+func (n *intervalNode) update() {
+	n.max = n.hi
+	if n.left != nil && n.left.max > n.max {
+		n.max = n.left.max
+	}
+	if n.right != nil && n.right.max > n.max {
+		n.max = n.right.max
+	}
+}
+
+func (x *intervalIndex) add(v string) matcher {
+	cp := *x
+	lo, hi, ok := parseRange(v)
+	if !ok {
+		cp.other = x.other.Set(v, struct{}{})
+		return &cp
+	}
+	i := interval{lo, hi, v}
+	if hasInterval(x.root, i) {
+		return x
+	}
+	l, r := splitIntervals(x.root, i)
+	n := &intervalNode{
+		interval: i,
+		prio:     rand.Uint32(),
+	}
+	n.update()
+	cp.root = mergeIntervals(mergeIntervals(l, n), r)
+	return &cp
+}
+
+func (x *intervalIndex) remove(v string) matcher {
+	cp := *x
+	lo, hi, ok := parseRange(v)
+	if !ok {
+		cp.other, _, _ = x.other.Delete(v)
+		return &cp
+	}
+	cp.root = deleteInterval(x.root, interval{lo, hi, v})
+	return &cp
+}
+
+func (x *intervalIndex) match(q []byte, it func(string) bool) bool {
+	if _, ok := x.other.Get(string(q)); ok && !it(string(q)) {
+		return false
+	}
+	// Stored value equal to the query one matches it even if it is an
+	// interval, e.g. when the query is made of stored values.
+	var exact bool
+	if lo, hi, ok := parseRange(string(q)); ok && hasInterval(x.root, interval{lo, hi, string(q)}) {
+		if !it(string(q)) {
+			return false
+		}
+		exact = true
+	}
+	p, err := strconv.ParseFloat(string(q), 64)
+	if err != nil || p != p {
+		return true
+	}
+	return stab(x.root, p, func(v string) bool {
+		// Do not report exact match twice.
+		return (exact && v == string(q)) || it(v)
+	})
+}
+
+// stab calls it for every interval of the subtree containing p.
+func stab(n *intervalNode, p float64, it func(string) bool) bool {
+	if n == nil || n.max < p {
+		return true
+	}
+	if !stab(n.left, p, it) {
+		return false
+	}
+	if n.lo > p {
+		// All intervals to the right start after p.
+		return true
+	}
+	if n.hi >= p && !it(n.value) {
+		return false
+	}
+	return stab(n.right, p, it)
+}
+
+// splitIntervals splits the subtree into intervals less than i and the rest.
+func splitIntervals(n *intervalNode, i interval) (l, r *intervalNode) {
+	if n == nil {
+		return nil, nil
+	}
+	cp := *n
+	if compareIntervals(n.interval, i) < 0 {
+		cp.right, r = splitIntervals(n.right, i)
+		cp.update()
+		return &cp, r
+	}
+	l, cp.left = splitIntervals(n.left, i)
+	cp.update()
+	return l, &cp
+}
+
+// mergeIntervals merges subtrees where all intervals of l are less than
+// intervals of r.
+func mergeIntervals(l, r *intervalNode) *intervalNode {
+	switch {
+	case l == nil:
+		return r
+	case r == nil:
+		return l
+	case l.prio > r.prio:
+		cp := *l
+		cp.right = mergeIntervals(l.right, r)
+		cp.update()
+		return &cp
+	default:
+		cp := *r
+		cp.left = mergeIntervals(l, r.left)
+		cp.update()
+		return &cp
+	}
+}
+
+func deleteInterval(n *intervalNode, i interval) *intervalNode {
+	if n == nil {
+		return nil
+	}
+	cp := *n
+	switch c := compareIntervals(i, n.interval); {
+	case c < 0:
+		cp.left = deleteInterval(n.left, i)
+	case c > 0:
+		cp.right = deleteInterval(n.right, i)
+	default:
+		return mergeIntervals(n.left, n.right)
+	}
+	cp.update()
+	return &cp
+}
+
+func hasInterval(n *intervalNode, i interval) bool {
+	for n != nil {
+		switch c := compareIntervals(i, n.interval); {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package radix
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// IPPrefix is a KeyKind of IP networks, like "10.0.0.0/8" or "2001:db8::/32".
+// Both IPv4 and IPv6 are supported.
+//
+// Stored values are prefixes in the format accepted by netip.ParsePrefix or
+// single addresses. Query values are addresses or prefixes. Stored prefix
+// matches query value if it contains it. Stored values which are not valid
+// prefixes are matched by equality.
+type IPPrefix struct {
+	// Longest makes lookups follow only the longest stored prefix containing
+	// query value instead of all of them.
+	Longest bool
+}
+
+func (p IPPrefix) newMatcher() matcher {
+	return &prefixIndex{longest: p.Longest}
+}
+
+// parsePrefix parses value of IPPrefix key. IPv4-mapped IPv6 addresses are
+// treated as IPv4 ones.
+func parsePrefix(v string) (netip.Prefix, bool) {
+	if a, err := netip.ParseAddr(v); err == nil {
+		a = a.Unmap().WithZone("")
+		return netip.PrefixFrom(a, a.BitLen()), true
+	}
+	p, err := netip.ParsePrefix(v)
+	if err != nil {
+		return p, false
+	}
+	if a := p.Addr(); a.Is4In6() {
+		bits := p.Bits() - 96
+		if bits < 0 {
+			return p, false
+		}
+		p = netip.PrefixFrom(a.Unmap(), bits)
+	}
+	return p.Masked(), true
+}
+
+// prefixIndex is a binary trie of prefixes. Its nodes are copied on write
+// along the path to the changed prefix.
+type prefixIndex struct {
+	longest bool
+	v4, v6  *prefixNode
+
+	// other holds values which are not valid prefixes.
+	other treap[string, struct{}]
+}
+
+type prefixNode struct {
+	// values holds stored values equal to the prefix of this node.
+	values   []string
+	children [2]*prefixNode
+}
+
+// prefixBits returns address bytes and number of significant bits of p.
+func prefixBits(p netip.Prefix) ([]byte, int) {
+	return p.Addr().AsSlice(), p.Bits()
+}
+
+func bitAt(b []byte, i int) int {
+	return int(b[i/8]>>(7-i%8)) & 1
+}
+
+func (x *prefixIndex) root(p netip.Prefix) **prefixNode {
+	if p.Addr().Is4() {
+		return &x.v4
+	}
+	return &x.v6
+}
+
+func (x *prefixIndex) add(v string) matcher {
+	cp := *x
+	p, ok := parsePrefix(v)
+	if !ok {
+		cp.other = x.other.Set(v, struct{}{})
+		return &cp
+	}
+	b, bits := prefixBits(p)
+	root := cp.root(p)
+	*root = (*root).update(b, 0, bits, func(values []string) []string {
+		if slices.Contains(values, v) {
+			return values
+		}
+		return append(slices.Clip(values), v)
+	})
+	return &cp
+}
+
+func (x *prefixIndex) remove(v string) matcher {
+	cp := *x
+	p, ok := parsePrefix(v)
+	if !ok {
+		cp.other, _, _ = x.other.Delete(v)
+		return &cp
+	}
+	b, bits := prefixBits(p)
+	root := cp.root(p)
+	*root = (*root).update(b, 0, bits, func(values []string) []string {
+		return slices.DeleteFunc(slices.Clone(values), func(s string) bool {
+			return s == v
+		})
+	})
+	return &cp
+}
+
+// update returns copy of the subtree at depth i where values of the prefix
+// made of first bits of b are replaced by the result of fn. It returns nil if
+// the resulting subtree is empty.
+func (n *prefixNode) update(b []byte, i, bits int, fn func([]string) []string) *prefixNode {
+	var cp prefixNode
+	if n != nil {
+		cp = *n
+	}
+	if i == bits {
+		cp.values = fn(cp.values)
+	} else {
+		bit := bitAt(b, i)
+		cp.children[bit] = cp.children[bit].update(b, i+1, bits, fn)
+	}
+	if len(cp.values) == 0 && cp.children[0] == nil && cp.children[1] == nil {
+		return nil
+	}
+	return &cp
+}
+
+func (x *prefixIndex) match(q []byte, it func(string) bool) bool {
+	if _, ok := x.other.Get(string(q)); ok && !it(string(q)) {
+		return false
+	}
+	p, ok := parsePrefix(string(q))
+	if !ok {
+		return true
+	}
+	var (
+		n       = *x.root(p)
+		b, bits = prefixBits(p)
+		longest []string
+	)
+	for i := 0; n != nil; i++ {
+		if x.longest {
+			if len(n.values) > 0 {
+				longest = n.values
+			}
+		} else {
+			for _, v := range n.values {
+				if !it(v) {
+					return false
+				}
+			}
+		}
+		if i == bits {
+			break
+		}
+		n = n.children[bitAt(b, i)]
+	}
+	for _, v := range longest {
+		if !it(v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,233 @@
+package radix
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONFormat describes JSON representation of a trie.
+type JSONFormat int
+
+const (
+	// JSONFlat is a newline delimited list of JSONRecord objects, one for
+	// every non-empty leaf.
+	JSONFlat JSONFormat = iota
+
+	// JSONNested is a single JSONLeaf object of the root leaf.
+	JSONNested
+)
+
+// JSONBinaryPrefix is a prefix of path values which are not valid UTF-8
+// strings, like Any, in JSON representation of a trie. Such values are
+// written as the prefix followed by base64 encoding of the value, since JSON
+// strings hold only UTF-8 text. Values beginning with the prefix are written
+// the same way.
+const JSONBinaryPrefix = "base64:"
+
+// JSONRecord is a JSON representation of leaf items along with the leaf
+// path. Path values are encoded as described by JSONBinaryPrefix.
+type JSONRecord[T any] struct {
+	Path  map[uint]string `json:"path"`
+	Items []T             `json:"items"`
+}
+
+// JSONLeaf is a JSON representation of a leaf with its child nodes.
+type JSONLeaf[T any] struct {
+	Items []T            `json:"items,omitempty"`
+	Nodes []*JSONNode[T] `json:"nodes,omitempty"`
+}
+
+// JSONNode is a JSON representation of a node with its leafs. Values of the
+// leafs are encoded as described by JSONBinaryPrefix.
+type JSONNode[T any] struct {
+	Key   uint                    `json:"key"`
+	Leafs map[string]*JSONLeaf[T] `json:"leafs"`
+}
+
+// ExportJSON writes trie contents to w in the given format. Items are
+// encoded with encoding/json package. Note that payloads are not exported.
+func (t *TrieOf[T]) ExportJSON(w io.Writer, format JSONFormat) error {
+	root := t.root.Load()
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	switch format {
+	case JSONFlat:
+		var err error
+		Dig(root, leafVisitor[T](func(trace []PairStr, leaf *LeafOf[T]) bool {
+			if leaf.ItemCount() == 0 {
+				return true
+			}
+			rec := JSONRecord[T]{
+				Path:  make(map[uint]string, len(trace)),
+				Items: leaf.AppendTo(nil),
+			}
+			for _, p := range trace {
+				rec.Path[p.Key] = encodeJSONValue(p.Value)
+			}
+			err = enc.Encode(rec)
+			return err == nil
+		}))
+		if err != nil {
+			return err
+		}
+	case JSONNested:
+		if err := enc.Encode(jsonLeaf(root)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("radix: unknown json format: %d", format)
+	}
+	return bw.Flush()
+}
+
+func jsonLeaf[T any](leaf *LeafOf[T]) *JSONLeaf[T] {
+	ret := &JSONLeaf[T]{
+		Items: leaf.AppendTo(nil),
+	}
+	leaf.AscendChildren(func(n *NodeOf[T]) bool {
+		node := &JSONNode[T]{
+			Key:   n.key,
+			Leafs: make(map[string]*JSONLeaf[T]),
+		}
+		n.AscendLeafs(func(v string, l *LeafOf[T]) bool {
+			node.Leafs[encodeJSONValue(v)] = jsonLeaf(l)
+			return true
+		})
+		ret.Nodes = append(ret.Nodes, node)
+		return true
+	})
+	return ret
+}
+
+func encodeJSONValue(v string) string {
+	if utf8.ValidString(v) && !strings.HasPrefix(v, JSONBinaryPrefix) {
+		return v
+	}
+	return JSONBinaryPrefix + base64.StdEncoding.EncodeToString([]byte(v))
+}
+
+func decodeJSONValue(v string) (string, error) {
+	s, ok := strings.CutPrefix(v, JSONBinaryPrefix)
+	if !ok {
+		return v, nil
+	}
+	p, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid binary value %q: %w", v, err)
+	}
+	return string(p), nil
+}
+
+// ImportJSON reads newline delimited JSONRecord objects from r and inserts
+// their items into the trie. Empty lines are skipped.
+//
+// Lines which could not be imported do not stop the import. Instead,
+// returned error is *JSONImportError describing every such line. It returns
+// number of imported records.
+func (t *TrieOf[T]) ImportJSON(r io.Reader) (n int, err error) {
+	var (
+		br     = bufio.NewReader(r)
+		failed []*JSONLineError
+	)
+	for line := 1; ; line++ {
+		p, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if len(bytes.TrimSpace(p)) > 0 {
+			if err := t.importJSONRecord(p); err != nil {
+				failed = append(failed, &JSONLineError{
+					Line: line,
+					Err:  err,
+				})
+			} else {
+				n++
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if len(failed) > 0 {
+		return n, &JSONImportError{Lines: failed}
+	}
+	return n, nil
+}
+
+func (t *TrieOf[T]) importJSONRecord(p []byte) error {
+	var rec JSONRecord[T]
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rec); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after record")
+	}
+	if rec.Path == nil {
+		return errors.New("path is missing")
+	}
+	if len(rec.Path) > MaxPathSize {
+		return fmt.Errorf("path is too long: %d keys", len(rec.Path))
+	}
+	for k, v := range rec.Path {
+		v, err := decodeJSONValue(v)
+		if err != nil {
+			return err
+		}
+		rec.Path[k] = v
+	}
+	path := PathFromMapStr(rec.Path)
+	for _, v := range rec.Items {
+		t.Insert(path, v)
+	}
+	return nil
+}
+
+// JSONLineError describes a line which could not be imported by ImportJSON.
+type JSONLineError struct {
+	Line int
+	Err  error
+}
+
+func (e *JSONLineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *JSONLineError) Unwrap() error {
+	return e.Err
+}
+
+// JSONImportError is returned by ImportJSON when some lines could not be
+// imported.
+type JSONImportError struct {
+	Lines []*JSONLineError
+}
+
+func (e *JSONImportError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "radix: could not import %d json lines: ", len(e.Lines))
+	for i, l := range e.Lines {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(l.Error())
+	}
+	return sb.String()
+}
+
+func (e *JSONImportError) Unwrap() []error {
+	errs := make([]error, len(e.Lines))
+	for i, l := range e.Lines {
+		errs[i] = l
+	}
+	return errs
+}
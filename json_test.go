@@ -0,0 +1,167 @@
+package radix_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	. "github.com/gobwas/radix"
+)
+
+func TestTrieExportJSON(t *testing.T) {
+	trie := New(nil)
+	for _, op := range []item{
+		{pairs{{1, "a"}, {2, "b"}}, 1},
+		{pairs{{1, "a"}, {2, "b"}}, 2},
+		{pairs{{1, "a"}}, 3},
+		{pairs{}, 4},
+	} {
+		trie.Insert(PathFromSliceStr(op.p), op.v)
+	}
+
+	var flat bytes.Buffer
+	if err := trie.ExportJSON(&flat, JSONFlat); err != nil {
+		t.Fatal(err)
+	}
+	act := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(flat.String()), "\n") {
+		act[line] = true
+	}
+	exp := map[string]bool{
+		`{"path":{},"items":[4]}`:                  true,
+		`{"path":{"1":"a"},"items":[3]}`:           true,
+		`{"path":{"1":"a","2":"b"},"items":[1,2]}`: true,
+	}
+	if !reflect.DeepEqual(act, exp) {
+		t.Errorf("flat json = %v; want %v", act, exp)
+	}
+
+	var nested bytes.Buffer
+	if err := trie.ExportJSON(&nested, JSONNested); err != nil {
+		t.Fatal(err)
+	}
+	var root JSONLeaf[uint]
+	if err := json.Unmarshal(nested.Bytes(), &root); err != nil {
+		t.Fatal(err)
+	}
+	expRoot := JSONLeaf[uint]{
+		Items: []uint{4},
+		Nodes: []*JSONNode[uint]{{
+			Key: 1,
+			Leafs: map[string]*JSONLeaf[uint]{
+				"a": {
+					Items: []uint{3},
+					Nodes: []*JSONNode[uint]{{
+						Key: 2,
+						Leafs: map[string]*JSONLeaf[uint]{
+							"b": {Items: []uint{1, 2}},
+						},
+					}},
+				},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(root, expRoot) {
+		t.Errorf("nested json = %s; want %+v", nested.String(), expRoot)
+	}
+
+	// Flat form could be imported back.
+	cp := New(nil)
+	if n, err := cp.ImportJSON(&flat); err != nil || n != 3 {
+		t.Fatalf("ImportJSON() = %d, %v; want 3, <nil>", n, err)
+	}
+	if a, b := trieItems(cp), trieItems(trie); !reflect.DeepEqual(a, b) {
+		t.Errorf("imported trie items = %v; want %v", a, b)
+	}
+}
+
+func TestTrieImportJSON(t *testing.T) {
+	input := strings.Join([]string{
+		`{"path":{"1":"a"},"items":[1,2]}`,
+		``,
+		`{"path":{"1":"b"},"items":["x"]}`,
+		`{"path":{"x":"b"},"items":[3]}`,
+		`{"path":{"2":"c"},"items":[4],"extra":1}`,
+		`not a json`,
+		`{"items":[5]}`,
+		`{"path":{"2":"c"},"items":[6]}`,
+	}, "\n")
+
+	trie := New(nil)
+	n, err := trie.ImportJSON(strings.NewReader(input))
+	if n != 2 {
+		t.Errorf("ImportJSON() imported %d records; want 2", n)
+	}
+	var ierr *JSONImportError
+	if !errors.As(err, &ierr) {
+		t.Fatalf("ImportJSON() error = %v; want *JSONImportError", err)
+	}
+	var lines []int
+	for _, l := range ierr.Lines {
+		lines = append(lines, l.Line)
+	}
+	if exp := []int{3, 4, 5, 6, 7}; !reflect.DeepEqual(lines, exp) {
+		t.Errorf("failed lines = %v; want %v", lines, exp)
+	}
+
+	exp := map[string]int{
+		"0x1:a;  1": 1,
+		"0x1:a;  2": 1,
+		"0x2:c;  6": 1,
+	}
+	if act := trieItems(trie); !reflect.DeepEqual(act, exp) {
+		t.Errorf("imported items = %v; want %v", act, exp)
+	}
+}
+
+func TestTrieJSONBinaryValues(t *testing.T) {
+	trie := New(nil)
+	for i, v := range []string{
+		"a",
+		Any,
+		"\xfe\x00\xff",
+		"base64:YQ==",
+		"ключ",
+	} {
+		trie.Insert(PathFromMapStr(map[uint]string{1: v}), uint(i))
+	}
+
+	var flat bytes.Buffer
+	if err := trie.ExportJSON(&flat, JSONFlat); err != nil {
+		t.Fatal(err)
+	}
+	cp := New(nil)
+	if n, err := cp.ImportJSON(bytes.NewReader(flat.Bytes())); err != nil || n != 5 {
+		t.Fatalf("ImportJSON() = %d, %v; want 5, <nil>", n, err)
+	}
+	if a, b := trieItems(cp), trieItems(trie); !reflect.DeepEqual(a, b) {
+		t.Errorf("imported trie items = %v; want %v", a, b)
+	}
+
+	var nested bytes.Buffer
+	if err := trie.ExportJSON(&nested, JSONNested); err != nil {
+		t.Fatal(err)
+	}
+	var root JSONLeaf[uint]
+	if err := json.Unmarshal(nested.Bytes(), &root); err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	for v := range root.Nodes[0].Leafs {
+		values = append(values, v)
+	}
+	slices.Sort(values)
+	exp := []string{"a", "base64:/gD/", "base64:/w==", "base64:YmFzZTY0OllRPT0=", "ключ"}
+	if !reflect.DeepEqual(values, exp) {
+		t.Errorf("nested json values = %q; want %q", values, exp)
+	}
+
+	_, err := New(nil).ImportJSON(strings.NewReader(`{"path":{"1":"base64:!"},"items":[1]}`))
+	if err == nil {
+		t.Errorf("ImportJSON() of malformed binary value = <nil>; want error")
+	}
+}
@@ -0,0 +1,158 @@
+package radix
+
+import (
+	"bytes"
+	"maps"
+	"strings"
+)
+
+// KeyKind describes how stored values of a key are matched against values of
+// the query by lookups. Values of keys without kind are matched by equality.
+// See TrieConfig.KeyKinds.
+//
+// Note that kinds only affect lookups made by the trie with such config.
+// Stored values are still inserted and deleted by equality.
+type KeyKind interface {
+	newMatcher() matcher
+}
+
+// keyKinds describes how stored values of keys are matched. It is shared by
+// all leafs and nodes of the trie and must not be changed. Nil keyKinds
+// matches values of every key by equality.
+type keyKinds struct {
+	kinds map[uint]KeyKind
+
+	// any holds keys which stored Any value matches any query value.
+	any map[uint]bool
+}
+
+func newKeyKinds(config *TrieConfig) *keyKinds {
+	if len(config.KeyKinds) == 0 && len(config.AnyKeys) == 0 {
+		return nil
+	}
+	k := &keyKinds{
+		kinds: maps.Clone(config.KeyKinds),
+	}
+	for _, key := range config.AnyKeys {
+		if k.any == nil {
+			k.any = make(map[uint]bool, len(config.AnyKeys))
+		}
+		k.any[key] = true
+	}
+	return k
+}
+
+// kind returns kind of the key or nil if key has no kind.
+func (k *keyKinds) kind(key uint) KeyKind {
+	if k == nil {
+		return nil
+	}
+	return k.kinds[key]
+}
+
+// matchesAny reports whether stored Any value of the key matches any query
+// value.
+func (k *keyKinds) matchesAny(key uint) bool {
+	return k != nil && k.any[key]
+}
+
+// matcher indexes stored values of a node to find those matching query
+// values. Matcher is never changed once created: add and remove return new
+// matcher which shares unchanged parts with the original one. Thus it is
+// shared by copies of the node and read without holding node's lock.
+type matcher interface {
+	// add returns matcher with v added.
+	add(v string) matcher
+
+	// remove returns matcher with v removed.
+	remove(v string) matcher
+
+	// match calls it for every stored value matching query value q.
+	match(q []byte, it func(v string) bool) bool
+}
+
+// Hierarchical is a KeyKind of values made of segments separated by
+// Separator, like topics "a.b.c" or locations "eu/de/berlin".
+//
+// Stored value matches query value if it is equal to the query value or to
+// one of its ancestors. That is, stored "eu/de" matches query "eu/de/berlin",
+// but not "eu/dex".
+type Hierarchical struct {
+	// Separator separates segments of values. It must not be empty.
+	Separator string
+}
+
+func (h Hierarchical) newMatcher() matcher {
+	if h.Separator == "" {
+		panic("radix: empty separator of hierarchical key")
+	}
+	return &segmentTree{sep: h.Separator}
+}
+
+// segmentTree is a prefix tree of value segments.
+type segmentTree struct {
+	sep  string
+	root *segmentNode
+}
+
+type segmentNode struct {
+	// stored is true if there is a stored value ending with this segment.
+	stored   bool
+	children treap[string, *segmentNode]
+}
+
+func (t *segmentTree) add(v string) matcher {
+	cp := *t
+	cp.root = t.root.set(strings.Split(v, t.sep), true)
+	return &cp
+}
+
+func (t *segmentTree) remove(v string) matcher {
+	cp := *t
+	cp.root = t.root.set(strings.Split(v, t.sep), false)
+	return &cp
+}
+
+// set returns copy of the subtree where value made of segs is stored or not.
+// It returns nil if the resulting subtree is empty.
+func (n *segmentNode) set(segs []string, stored bool) *segmentNode {
+	var cp segmentNode
+	if n != nil {
+		cp = *n
+	}
+	if len(segs) == 0 {
+		cp.stored = stored
+	} else {
+		child, _ := cp.children.Get(segs[0])
+		if child = child.set(segs[1:], stored); child != nil {
+			cp.children = cp.children.Set(segs[0], child)
+		} else {
+			cp.children, _, _ = cp.children.Delete(segs[0])
+		}
+	}
+	if !cp.stored && cp.children.Len() == 0 {
+		return nil
+	}
+	return &cp
+}
+
+func (t *segmentTree) match(q []byte, it func(string) bool) bool {
+	n := t.root
+	for i := 0; n != nil; {
+		end := len(q)
+		if j := bytes.Index(q[i:], []byte(t.sep)); j >= 0 {
+			end = i + j
+		}
+		if n, _ = n.children.Get(string(q[i:end])); n == nil {
+			return true
+		}
+		if n.stored && !it(string(q[:end])) {
+			return false
+		}
+		if end == len(q) {
+			return true
+		}
+		i = end + len(t.sep)
+	}
+	return true
+}
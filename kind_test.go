@@ -0,0 +1,457 @@
+package radix_test
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+
+	. "github.com/gobwas/radix"
+)
+
+func TestTrieLookupHierarchical(t *testing.T) {
+	kinds := map[uint]KeyKind{
+		1: Hierarchical{Separator: "/"},
+	}
+	entries := []Entry[uint]{
+		{Path: PathFromMapStr(map[uint]string{1: "eu"}), Item: 1},
+		{Path: PathFromMapStr(map[uint]string{1: "eu/de"}), Item: 2},
+		{Path: PathFromMapStr(map[uint]string{1: "eu/de/berlin"}), Item: 3},
+		{Path: PathFromMapStr(map[uint]string{1: "eu/fr"}), Item: 4},
+		{Path: PathFromMapStr(map[uint]string{1: "eu/dex"}), Item: 5},
+		{Path: PathFromMapStr(map[uint]string{1: Any}), Item: 6},
+		{Path: PathFromMapStr(map[uint]string{1: "eu/de", 2: "x"}), Item: 7},
+	}
+	insert := func(config *TrieConfig) *Trie {
+		trie := New(config)
+		for _, e := range entries {
+			trie.Insert(e.Path, e.Item)
+		}
+		return trie
+	}
+	build := func(config *TrieConfig) *Trie {
+		var i int
+		return Build(func() (e Entry[uint], ok bool) {
+			if i < len(entries) {
+				e, ok = entries[i], true
+				i++
+			}
+			return
+		}, config)
+	}
+	for _, test := range []struct {
+		name   string
+		config *TrieConfig
+		create func(*TrieConfig) *Trie
+	}{
+		{"default", &TrieConfig{KeyKinds: kinds, AnyKeys: []uint{1}}, insert},
+		{"order", &TrieConfig{KeyKinds: kinds, AnyKeys: []uint{1}, NodeOrder: []uint{2}}, insert},
+		{"persistent", &TrieConfig{KeyKinds: kinds, AnyKeys: []uint{1}, Persistent: true}, insert},
+		{"build", &TrieConfig{KeyKinds: kinds, AnyKeys: []uint{1}}, build},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			trie := test.create(test.config)
+
+			lookup := func(m map[uint]string, s LookupStrategy) (ret []uint) {
+				q := PathFromMapStr(m)
+				it := func(v uint) bool {
+					ret = append(ret, v)
+					return true
+				}
+				switch s {
+				case LookupStrategyStrict:
+					trie.LookupStrict(q, it)
+				case LookupStrategyGreedy:
+					trie.LookupGreedy(q, it)
+				}
+				slices.Sort(ret)
+				return ret
+			}
+			for _, c := range []struct {
+				query map[uint]string
+				s     LookupStrategy
+				exp   []uint
+			}{
+				{map[uint]string{1: "eu/de/berlin"}, LookupStrategyStrict, []uint{1, 2, 3, 6}},
+				{map[uint]string{1: "eu/de/munich"}, LookupStrategyStrict, []uint{1, 2, 6}},
+				{map[uint]string{1: "eu/dex"}, LookupStrategyStrict, []uint{1, 5, 6}},
+				{map[uint]string{1: "us"}, LookupStrategyStrict, []uint{6}},
+				{map[uint]string{1: "eu/de", 2: "x"}, LookupStrategyStrict, []uint{7}},
+				{map[uint]string{1: "eu/de", 2: "x"}, LookupStrategyGreedy, []uint{1, 2, 6, 7}},
+			} {
+				if act := lookup(c.query, c.s); !reflect.DeepEqual(act, c.exp) {
+					t.Errorf("lookup(%v, %v) = %v; want %v", c.query, c.s, act, c.exp)
+				}
+			}
+
+			// Leafs matching several values of the query are reported once.
+			var act []uint
+			q := NewQuery(Path{}).In(1, []byte("eu/de/berlin"), []byte("eu/de/munich"))
+			trie.LookupQuery(q, LookupStrategyStrict, func(v uint) bool {
+				act = append(act, v)
+				return true
+			})
+			slices.Sort(act)
+			if exp := []uint{1, 2, 3, 6}; !reflect.DeepEqual(act, exp) {
+				t.Errorf("LookupQuery(%s) = %v; want %v", q, act, exp)
+			}
+
+			// Exact paths are still required to delete items.
+			if trie.Delete(PathFromMapStr(map[uint]string{1: "eu/de/berlin"}), 2) {
+				t.Errorf("Delete() = true; want false")
+			}
+			if !trie.Delete(PathFromMapStr(map[uint]string{1: "eu/de/berlin"}), 3) {
+				t.Errorf("Delete() = false; want true")
+			}
+			if act, exp := lookup(map[uint]string{1: "eu/de/berlin"}, LookupStrategyStrict), []uint{1, 2, 6}; !reflect.DeepEqual(act, exp) {
+				t.Errorf("after Delete() items are %v; want %v", act, exp)
+			}
+			trie.Insert(PathFromMapStr(map[uint]string{1: "eu/de/berlin/mitte"}), 8)
+			if act, exp := lookup(map[uint]string{1: "eu/de/berlin/mitte"}, LookupStrategyStrict), []uint{1, 2, 6, 8}; !reflect.DeepEqual(act, exp) {
+				t.Errorf("after Insert() items are %v; want %v", act, exp)
+			}
+		})
+	}
+}
+
+func TestTrieLookupRange(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config *TrieConfig
+	}{
+		{"default", &TrieConfig{KeyKinds: map[uint]KeyKind{1: Range{}}}},
+		{"persistent", &TrieConfig{KeyKinds: map[uint]KeyKind{1: Range{}}, Persistent: true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			trie := New(test.config)
+			trie.Insert(PathFromMapStr(map[uint]string{1: RangeValue(10, 100)}), 1)
+			trie.Insert(PathFromMapStr(map[uint]string{1: RangeValue(3.2, math.Inf(1))}), 2)
+			trie.Insert(PathFromMapStr(map[uint]string{1: "50"}), 3)
+			trie.Insert(PathFromMapStr(map[uint]string{1: "cheap"}), 4)
+			trie.Insert(PathFromMapStr(map[uint]string{1: RangeValue(0, 20), 2: "x"}), 5)
+
+			lookup := func(m map[uint]string) (ret []uint) {
+				trie.LookupStrict(PathFromMapStr(m), func(v uint) bool {
+					ret = append(ret, v)
+					return true
+				})
+				slices.Sort(ret)
+				return ret
+			}
+			for _, c := range []struct {
+				query map[uint]string
+				exp   []uint
+			}{
+				{map[uint]string{1: "1"}, nil},
+				{map[uint]string{1: "3.2"}, []uint{2}},
+				{map[uint]string{1: "10"}, []uint{1, 2}},
+				{map[uint]string{1: "5e1"}, []uint{1, 2, 3}},
+				{map[uint]string{1: "1000"}, []uint{2}},
+				{map[uint]string{1: "cheap"}, []uint{4}},
+				{map[uint]string{1: "NaN"}, nil},
+				{map[uint]string{1: "15", 2: "x"}, []uint{5}},
+
+				// Stored values match themselves, but intervals are not
+				// matched by containment.
+				{map[uint]string{1: "50"}, []uint{1, 2, 3}},
+				{map[uint]string{1: RangeValue(10, 100)}, []uint{1}},
+				{map[uint]string{1: RangeValue(3.2, math.Inf(1))}, []uint{2}},
+				{map[uint]string{1: RangeValue(20, 30)}, nil},
+				{map[uint]string{1: RangeValue(0, 20), 2: "x"}, []uint{5}},
+			} {
+				if act := lookup(c.query); !reflect.DeepEqual(act, c.exp) {
+					t.Errorf("lookup(%v) = %v; want %v", c.query, act, c.exp)
+				}
+			}
+
+			if !trie.Delete(PathFromMapStr(map[uint]string{1: RangeValue(10, 100)}), 1) {
+				t.Errorf("Delete() = false; want true")
+			}
+			if act, exp := lookup(map[uint]string{1: "50"}), []uint{2, 3}; !reflect.DeepEqual(act, exp) {
+				t.Errorf("after Delete() items are %v; want %v", act, exp)
+			}
+		})
+	}
+}
+
+func TestTrieLookupRangeRandom(t *testing.T) {
+	type entry struct {
+		lo, hi float64
+		item   uint
+	}
+	var (
+		trie    = New(&TrieConfig{KeyKinds: map[uint]KeyKind{1: Range{}}})
+		entries []entry
+	)
+	for i := uint(0); i < 200; i++ {
+		lo := float64(rand.Intn(100))
+		hi := lo + float64(rand.Intn(20))
+		trie.Insert(PathFromMapStr(map[uint]string{1: RangeValue(lo, hi)}), i)
+		entries = append(entries, entry{lo, hi, i})
+	}
+	// Lookup builds the index, so deletions below must update it.
+	trie.LookupStrict(PathFromMapStr(map[uint]string{1: "0"}), func(uint) bool { return true })
+	for i := 0; i < 50; i++ {
+		e := entries[rand.Intn(len(entries))]
+		trie.Delete(PathFromMapStr(map[uint]string{1: RangeValue(e.lo, e.hi)}), e.item)
+		entries = slices.DeleteFunc(entries, func(x entry) bool {
+			return x.item == e.item
+		})
+	}
+	for p := -1.0; p <= 120; p += 0.5 {
+		var exp, act []uint
+		for _, e := range entries {
+			if e.lo <= p && p <= e.hi {
+				exp = append(exp, e.item)
+			}
+		}
+		trie.LookupStrict(PathFromMapStr(map[uint]string{1: strconv.FormatFloat(p, 'f', -1, 64)}), func(v uint) bool {
+			act = append(act, v)
+			return true
+		})
+		slices.Sort(exp)
+		slices.Sort(act)
+		if !reflect.DeepEqual(act, exp) {
+			t.Fatalf("lookup(%v) = %v; want %v", p, act, exp)
+		}
+	}
+}
+
+func TestTrieLookupIPPrefix(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		longest bool
+		exp     map[string][]uint
+	}{
+		{
+			name: "all",
+			exp: map[string][]uint{
+				"10.1.2.3":        {1, 2, 3},
+				"10.2.0.1":        {1, 2},
+				"10.1.0.0/16":     {1, 2, 3},
+				"10.0.0.0/7":      {1},
+				"11.0.0.1":        {1},
+				"::ffff:10.2.0.1": {1, 2},
+				"2001:db8::1":     {4, 5},
+				"2001:db8:1::1":   {4, 5, 6},
+				"fe80::1%eth0":    {4},
+				"local":           {7},
+				"10.1.2":          nil,
+			},
+		},
+		{
+			name:    "longest",
+			longest: true,
+			exp: map[string][]uint{
+				"10.1.2.3":      {3},
+				"10.2.0.1":      {2},
+				"2001:db8::1":   {5},
+				"2001:db8:1::1": {6},
+				"local":         {7},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			trie := New(&TrieConfig{
+				KeyKinds: map[uint]KeyKind{1: IPPrefix{Longest: test.longest}},
+			})
+			for i, v := range []string{
+				"0.0.0.0/0",
+				"10.0.0.0/8",
+				"10.1.0.0/16",
+				"::/0",
+				"2001:db8::/32",
+				"2001:db8:1::/48",
+				"local",
+			} {
+				trie.Insert(PathFromMapStr(map[uint]string{1: v}), uint(i+1))
+			}
+			for q, exp := range test.exp {
+				var act []uint
+				trie.LookupStrict(PathFromMapStr(map[uint]string{1: q}), func(v uint) bool {
+					act = append(act, v)
+					return true
+				})
+				slices.Sort(act)
+				if !reflect.DeepEqual(act, exp) {
+					t.Errorf("lookup(%s) = %v; want %v", q, act, exp)
+				}
+			}
+
+			if !trie.Delete(PathFromMapStr(map[uint]string{1: "10.1.0.0/16"}), 3) {
+				t.Errorf("Delete() = false; want true")
+			}
+			var act []uint
+			trie.LookupStrict(PathFromMapStr(map[uint]string{1: "10.1.2.3"}), func(v uint) bool {
+				act = append(act, v)
+				return true
+			})
+			slices.Sort(act)
+			exp := []uint{1, 2}
+			if test.longest {
+				exp = []uint{2}
+			}
+			if !reflect.DeepEqual(act, exp) {
+				t.Errorf("after Delete() items are %v; want %v", act, exp)
+			}
+		})
+	}
+}
+
+func TestTrieLookupPattern(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		kind     KeyKind
+		patterns []string
+		exp      map[string][]uint
+
+		// candidates holds patterns evaluated by lookups. Patterns which
+		// literal prefix does not match the query must be skipped.
+		candidates map[string][]string
+	}{
+		{
+			name: "regexp",
+			kind: Regexp{},
+			patterns: []string{
+				`Mozilla.*`,
+				`Mozilla/5\.0 .*Firefox.*`,
+				`.*bot.*`,
+				`(?i)curl/.*`,
+				`[`,
+			},
+			exp: map[string][]uint{
+				"Mozilla/5.0 (X11) Firefox/120.0": {1, 2},
+				"Mozilla/4.0":                     {1},
+				"xMozilla":                        nil,
+				"Googlebot/2.1":                   {3},
+				"CURL/8.0":                        {4},
+				"[":                               {5},
+			},
+			candidates: map[string][]string{
+				"Mozilla/5.0 (X11) Firefox/120.0": {`.*bot.*`, `(?i)curl/.*`, `Mozilla.*`, `Mozilla/5\.0 .*Firefox.*`},
+				"Mozilla/4.0":                     {`.*bot.*`, `(?i)curl/.*`, `Mozilla.*`},
+				"Googlebot/2.1":                   {`.*bot.*`, `(?i)curl/.*`},
+			},
+		},
+		{
+			name: "glob",
+			kind: Glob{},
+			patterns: []string{
+				`Mozilla*`,
+				`Mozilla/5.0 *Firefox*`,
+				`*bot*`,
+				`curl/?.?`,
+				`\*`,
+			},
+			exp: map[string][]uint{
+				"Mozilla/5.0 (X11) Firefox/120.0": {1, 2},
+				"Mozilla/5x0 (X11) Firefox/120.0": {1},
+				"Googlebot/2.1":                   {3},
+				"curl/8.0":                        {4},
+				"curl/8.10":                       nil,
+				"*":                               {5},
+				"**":                              nil,
+			},
+			candidates: map[string][]string{
+				"Mozilla/5.0 (X11) Firefox/120.0": {`*bot*`, `Mozilla*`, `Mozilla/5.0 *Firefox*`},
+				"Mozilla/5x0 (X11) Firefox/120.0": {`*bot*`, `Mozilla*`},
+				"Googlebot/2.1":                   {`*bot*`},
+				"curl/8.0":                        {`*bot*`, `curl/?.?`},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for q, exp := range test.candidates {
+				act := PatternCandidates(test.kind, test.patterns, q)
+				slices.Sort(act)
+				slices.Sort(exp)
+				if !reflect.DeepEqual(act, exp) {
+					t.Errorf("patterns evaluated for %q are %q; want %q", q, act, exp)
+				}
+			}
+			for _, config := range []*TrieConfig{
+				{KeyKinds: map[uint]KeyKind{1: test.kind}},
+				{KeyKinds: map[uint]KeyKind{1: test.kind}, Persistent: true},
+			} {
+				trie := New(config)
+				for i, p := range test.patterns {
+					trie.Insert(PathFromMapStr(map[uint]string{1: p}), uint(i+1))
+				}
+				for q, exp := range test.exp {
+					var act []uint
+					trie.LookupStrict(PathFromMapStr(map[uint]string{1: q}), func(v uint) bool {
+						act = append(act, v)
+						return true
+					})
+					slices.Sort(act)
+					if !reflect.DeepEqual(act, exp) {
+						t.Errorf("lookup(%q) = %v; want %v", q, act, exp)
+					}
+				}
+				if !trie.Delete(PathFromMapStr(map[uint]string{1: test.patterns[0]}), 1) {
+					t.Errorf("Delete() = false; want true")
+				}
+				var act []uint
+				trie.LookupStrict(PathFromMapStr(map[uint]string{1: "Mozilla/5.0 (X11) Firefox/120.0"}), func(v uint) bool {
+					act = append(act, v)
+					return true
+				})
+				if exp := []uint{2}; !reflect.DeepEqual(act, exp) {
+					t.Errorf("after Delete() items are %v; want %v", act, exp)
+				}
+			}
+		})
+	}
+}
+
+func TestTrieLookupKindSnapshot(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		kind   KeyKind
+		values []string
+		query  string
+	}{
+		{"hierarchical", Hierarchical{Separator: "/"}, []string{"eu", "eu/de", "eu/de/berlin"}, "eu/de/berlin"},
+		{"range", Range{}, []string{RangeValue(0, 10), RangeValue(5, 15), "7"}, "7"},
+		{"ipprefix", IPPrefix{}, []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.3"}, "10.1.2.3"},
+		{"regexp", Regexp{}, []string{"a.*", "ab.*", "abc"}, "abc"},
+		{"glob", Glob{}, []string{"a*", "ab*", "abc"}, "abc"},
+	} {
+		for _, persistent := range []bool{false, true} {
+			name := test.name
+			if persistent {
+				name += "/persistent"
+			}
+			t.Run(name, func(t *testing.T) {
+				trie := New(&TrieConfig{
+					KeyKinds:   map[uint]KeyKind{1: test.kind},
+					Persistent: persistent,
+				})
+				lookup := func(trie *Trie) (ret []uint) {
+					trie.LookupStrict(PathFromMapStr(map[uint]string{1: test.query}), func(v uint) bool {
+						ret = append(ret, v)
+						return true
+					})
+					slices.Sort(ret)
+					return ret
+				}
+				for i, v := range test.values[:2] {
+					trie.Insert(PathFromMapStr(map[uint]string{1: v}), uint(i+1))
+				}
+				snap := trie.Snapshot()
+
+				trie.Delete(PathFromMapStr(map[uint]string{1: test.values[0]}), 1)
+				trie.Insert(PathFromMapStr(map[uint]string{1: test.values[2]}), 3)
+
+				if act, exp := lookup(snap), []uint{1, 2}; !reflect.DeepEqual(act, exp) {
+					t.Errorf("snapshot items are %v; want %v", act, exp)
+				}
+				if act, exp := lookup(trie), []uint{2, 3}; !reflect.DeepEqual(act, exp) {
+					t.Errorf("trie items are %v; want %v", act, exp)
+				}
+			})
+		}
+	}
+}
@@ -1,10 +1,10 @@
 package radix
 
-//go:generate ppgo
-
 import (
+	"cmp"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/google/btree"
 )
@@ -13,100 +13,204 @@ const (
 	degree = 128
 )
 
-type Leaf struct {
-	parent *Node
+// Leaf is a LeafOf uint items.
+type Leaf = LeafOf[uint]
+
+// LeafOf holds items of type T and child nodes.
+type LeafOf[T any] struct {
+	parent *NodeOf[T]
 	value  string
 
+	// cmp is used to keep items in order.
+	cmp func(a, b T) int
+
+	// kinds is passed to the child nodes.
+	kinds *keyKinds
+
 	// dmu holds mutex for data manipulation.
 	dmu sync.RWMutex
 
-	// If leaf data is at most array.Cap(), uint sorted array is used.
+	// If leaf data is at most array.Cap(), sorted array is used.
 	// Otherwise BTree will hold the data.
-	array uintArray
-	btree *btree.BTree
+	array itemArray[T]
+	btree *btree.BTreeG[leafItem[T]]
 
-	children *nodeSyncSlice
+	// cmu holds mutex for children manipulation. Children are never changed
+	// in place, thus they are read without holding cmu.
+	cmu      sync.Mutex
+	children atomic.Pointer[treapNode[uint, *NodeOf[T]]]
 }
 
-// newLeaf creates leaf with parent node.
+// NewLeaf creates leaf of uint items with parent node.
 func NewLeaf(parent *Node, value string) *Leaf {
-	return &Leaf{
-		parent:   parent,
-		value:    value,
-		children: &nodeSyncSlice{},
+	return NewLeafOf(parent, value, cmp.Compare[uint])
+}
+
+// NewLeafOf creates leaf with parent node. Given compare function is used to
+// order leaf items. It must return negative number if a is less than b,
+// positive if a is greater than b and zero if a is equal to b.
+func NewLeafOf[T any](parent *NodeOf[T], value string, compare func(a, b T) int) *LeafOf[T] {
+	l := &LeafOf[T]{
+		parent: parent,
+		value:  value,
+		cmp:    compare,
+	}
+	if parent != nil {
+		l.kinds = parent.kinds
 	}
+	return l
 }
 
-func (l *Leaf) Parent() *Node {
+func (l *LeafOf[T]) Parent() *NodeOf[T] {
 	return l.parent
 }
 
-func (l *Leaf) Value() string {
+func (l *LeafOf[T]) Value() string {
 	return l.value
 }
 
-func (l *Leaf) HasChild(key uint) bool {
-	return l.children.Has(key)
+// Path returns path from the trie root to the leaf.
+func (l *LeafOf[T]) Path() Path {
+	var pairs []Pair
+	for l != nil && l.parent != nil {
+		n := l.parent
+		pairs = append(pairs, Pair{n.key, []byte(l.value)})
+		l = n.parent
+	}
+	return PathFromSliceBorrow(pairs)
 }
 
-func (l *Leaf) AddChild(n *Node) {
-	prev, _ := l.children.Upsert(n)
-	n.parent = l
-	if prev != nil {
+// nodes returns children of l ordered by keys.
+func (l *LeafOf[T]) nodes() treap[uint, *NodeOf[T]] {
+	return treap[uint, *NodeOf[T]]{l.children.Load()}
+}
+
+// setNodes replaces children of l.
+// Caller must hold l.cmu.
+func (l *LeafOf[T]) setNodes(nodes treap[uint, *NodeOf[T]]) {
+	l.children.Store(nodes.root)
+}
+
+func (l *LeafOf[T]) HasChild(key uint) bool {
+	_, ok := l.nodes().Get(key)
+	return ok
+}
+
+func (l *LeafOf[T]) AddChild(n *NodeOf[T]) {
+	l.cmu.Lock()
+	nodes := l.nodes()
+	_, has := nodes.Get(n.key)
+	if !has {
+		l.setNodes(nodes.Set(n.key, n))
+	}
+	l.cmu.Unlock()
+	if has {
 		panic(fmt.Sprintf("leaf already has child with key %v", n.key))
 	}
+	n.parent = l
 }
 
-func (l *Leaf) GetChild(key uint) *Node {
-	n, _ := l.children.Get(key)
+func (l *LeafOf[T]) GetChild(key uint) *NodeOf[T] {
+	n, _ := l.nodes().Get(key)
 	return n
 }
 
-func (l *Leaf) ChildrenCount() int {
-	return l.children.Len()
+func (l *LeafOf[T]) ChildrenCount() int {
+	return l.nodes().Len()
 }
 
-func (l *Leaf) GetsertChild(key uint) (node *Node, inserted bool) {
-	node = l.children.GetsertFn(key, func() *Node {
-		inserted = true
-		return &Node{
-			key:    key,
-			parent: l,
-		}
-	})
-	return
+func (l *LeafOf[T]) GetsertChild(key uint) (node *NodeOf[T], inserted bool) {
+	if n, ok := l.nodes().Get(key); ok {
+		return n, false
+	}
+	l.cmu.Lock()
+	defer l.cmu.Unlock()
+	nodes := l.nodes()
+	if n, ok := nodes.Get(key); ok {
+		return n, false
+	}
+	node = &NodeOf[T]{
+		key:    key,
+		cmp:    l.cmp,
+		kinds:  l.kinds,
+		parent: l,
+	}
+	l.setNodes(nodes.Set(key, node))
+	return node, true
+}
+
+// putChild inserts n to the children of l or replaces existing child with the
+// same key.
+func (l *LeafOf[T]) putChild(n *NodeOf[T]) {
+	l.cmu.Lock()
+	l.setNodes(l.nodes().Set(n.key, n))
+	l.cmu.Unlock()
 }
 
-func (l *Leaf) RemoveChild(key uint) *Node {
-	prev, _ := l.children.Delete(key)
+func (l *LeafOf[T]) RemoveChild(key uint) *NodeOf[T] {
+	l.cmu.Lock()
+	nodes, prev, _ := l.nodes().Delete(key)
+	l.setNodes(nodes)
+	l.cmu.Unlock()
 	return prev
 }
 
-func (l *Leaf) RemoveEmptyChild(key uint) (*Node, bool) {
-	return l.children.DeleteCond(key, (*Node).Empty)
+func (l *LeafOf[T]) RemoveEmptyChild(key uint) (*NodeOf[T], bool) {
+	l.cmu.Lock()
+	defer l.cmu.Unlock()
+	nodes := l.nodes()
+	if n, ok := nodes.Get(key); !ok || !n.Empty() {
+		return nil, false
+	}
+	nodes, prev, _ := nodes.Delete(key)
+	l.setNodes(nodes)
+	return prev, true
 }
 
-func (l *Leaf) AscendChildren(cb func(*Node) bool) (ok bool) {
-	return l.children.Ascend(cb)
+func (l *LeafOf[T]) AscendChildren(cb func(*NodeOf[T]) bool) (ok bool) {
+	return l.nodes().Ascend(func(_ uint, n *NodeOf[T]) bool {
+		return cb(n)
+	})
 }
 
-func (l *Leaf) AscendChildrenRange(a, b uint, cb func(*Node) bool) (ok bool) {
-	return l.children.AscendRange(a, b, cb)
+func (l *LeafOf[T]) AscendChildrenRange(a, b uint, cb func(*NodeOf[T]) bool) (ok bool) {
+	return l.nodes().AscendRange(a, b, func(_ uint, n *NodeOf[T]) bool {
+		return cb(n)
+	})
 }
 
-func (l *Leaf) GetAny(it func() (uint, bool)) (*Node, bool) {
-	return l.children.GetAny(it)
+// GetAny returns the first child which key is returned by it.
+func (l *LeafOf[T]) GetAny(it func() (uint, bool)) (*NodeOf[T], bool) {
+	nodes := l.nodes()
+	for {
+		k, ok := it()
+		if !ok {
+			return nil, false
+		}
+		if n, ok := nodes.Get(k); ok {
+			return n, true
+		}
+	}
 }
 
-func (l *Leaf) GetsertAny(it func() (uint, bool), add func() *Node) *Node {
-	return l.children.GetsertAnyFn(it, add)
+// GetsertAny is like GetAny, but if there is no such child, it inserts the
+// one returned by add.
+func (l *LeafOf[T]) GetsertAny(it func() (uint, bool), add func() *NodeOf[T]) *NodeOf[T] {
+	l.cmu.Lock()
+	defer l.cmu.Unlock()
+	if n, ok := l.GetAny(it); ok {
+		return n
+	}
+	n := add()
+	l.setNodes(l.nodes().Set(n.key, n))
+	return n
 }
 
-func (l *Leaf) AppendTo(p []uint) []uint {
+func (l *LeafOf[T]) AppendTo(p []T) []T {
 	l.dmu.RLock()
 	if l.btree != nil {
-		l.btree.Ascend(func(x btree.Item) bool {
-			p = append(p, uint(x.(btreeUint)))
+		l.btree.Ascend(func(x leafItem[T]) bool {
+			p = append(p, x.value)
 			return true
 		})
 		l.dmu.RUnlock()
@@ -118,14 +222,14 @@ func (l *Leaf) AppendTo(p []uint) []uint {
 	return array.AppendTo(p)
 }
 
-func (l *Leaf) Empty() bool {
-	if l.children.Len() > 0 {
+func (l *LeafOf[T]) Empty() bool {
+	if l.children.Load() != nil {
 		return false
 	}
 	return l.ItemCount() == 0
 }
 
-func (l *Leaf) ItemCount() int {
+func (l *LeafOf[T]) ItemCount() int {
 	l.dmu.RLock()
 	var n int
 	if l.btree != nil {
@@ -139,26 +243,35 @@ func (l *Leaf) ItemCount() int {
 
 // Append appends v to leaf values.
 // It returns true if v was not present there.
-// Note that zero v will not report correct ok value.
-func (l *Leaf) Append(v uint) (ok bool) {
+// It is the same as AppendWithPayload(v, nil).
+func (l *LeafOf[T]) Append(v T) (ok bool) {
+	return l.AppendWithPayload(v, nil)
+}
+
+// AppendWithPayload appends v to leaf values and associates payload with it.
+// If v is already present, its payload is replaced by the given one.
+// It returns true if v was not present there.
+func (l *LeafOf[T]) AppendWithPayload(v T, payload any) (ok bool) {
+	x := leafItem[T]{v, payload}
+
 	l.dmu.Lock()
 	switch {
 	case l.array.Len() == l.array.Cap():
-		l.btree = btree.New(degree)
-		l.array.Ascend(func(v uint) bool {
-			l.btree.ReplaceOrInsert(btreeUint(v))
+		l.btree = btree.NewG(degree, l.less)
+		l.array.Ascend(func(x leafItem[T]) bool {
+			l.btree.ReplaceOrInsert(x)
 			return true
 		})
 		l.array = l.array.Reset()
 		fallthrough
 
 	case l.btree != nil:
-		prev := l.btree.ReplaceOrInsert(btreeUint(v))
-		ok = prev == nil
+		_, replaced := l.btree.ReplaceOrInsert(x)
+		ok = !replaced
 
 	default:
 		var replaced bool
-		l.array, _, replaced = l.array.Upsert(v)
+		l.array, _, replaced = l.array.Upsert(x, l.cmp)
 		ok = !replaced
 	}
 	l.dmu.Unlock()
@@ -166,29 +279,56 @@ func (l *Leaf) Append(v uint) (ok bool) {
 	return
 }
 
+// Payload returns payload associated with v. It returns false if v is not
+// present in leaf values.
+func (l *LeafOf[T]) Payload(v T) (payload any, ok bool) {
+	var x leafItem[T]
+	l.dmu.RLock()
+	if l.btree != nil {
+		x, ok = l.btree.Get(leafItem[T]{value: v})
+	} else {
+		x, ok = l.array.Get(v, l.cmp)
+	}
+	l.dmu.RUnlock()
+	return x.payload, ok
+}
+
 // Remove removes v from leafs values. It returns true if v was present there.
-func (l *Leaf) Remove(v uint) (ok bool) {
+func (l *LeafOf[T]) Remove(v T) (ok bool) {
 	l.dmu.Lock()
 	if l.btree != nil {
-		ok = l.btree.Delete(btreeUint(v)) != nil
+		_, ok = l.btree.Delete(leafItem[T]{value: v})
 		if l.btree.Len() == 0 {
 			l.btree = nil
 		}
 	} else {
-		l.array, _, ok = l.array.Delete(v)
+		l.array, _, ok = l.array.Delete(v, l.cmp)
 	}
 	l.dmu.Unlock()
 	return
 }
 
-func (l *Leaf) Ascend(it Iterator) bool {
+func (l *LeafOf[T]) Ascend(it func(T) bool) bool {
+	return l.ascend(func(x leafItem[T]) bool {
+		return it(x.value)
+	})
+}
+
+// AscendWithPayload calls it for every leaf value and its payload.
+func (l *LeafOf[T]) AscendWithPayload(it func(T, any) bool) bool {
+	return l.ascend(func(x leafItem[T]) bool {
+		return it(x.value, x.payload)
+	})
+}
+
+func (l *LeafOf[T]) ascend(it func(leafItem[T]) bool) bool {
 	var (
 		ok = true
 	)
 	l.dmu.RLock()
 	if l.btree != nil {
-		l.btree.Ascend(func(i btree.Item) bool {
-			ok = it(uint(i.(btreeUint)))
+		l.btree.Ascend(func(x leafItem[T]) bool {
+			ok = it(x)
 			return ok
 		})
 		l.dmu.RUnlock()
@@ -200,10 +340,17 @@ func (l *Leaf) Ascend(it Iterator) bool {
 	return array.Ascend(it)
 }
 
-// Inserter contains options for inserting values into the tree.
-type Inserter struct {
+func (l *LeafOf[T]) less(a, b leafItem[T]) bool {
+	return l.cmp(a.value, b.value) < 0
+}
+
+// Inserter is an InserterOf uint items.
+type Inserter = InserterOf[uint]
+
+// InserterOf contains options for inserting values into the tree.
+type InserterOf[T any] struct {
 	// IndexNode is a callback that will be called on every newly created Node.
-	IndexNode func(*Node)
+	IndexNode func(*NodeOf[T])
 
 	// NodeOrder is an order of node keys, that should be kept during insertion.
 	// That is, when we insert path {1:a;2:b;3:c} and NodeOrder is [2,3],
@@ -220,19 +367,27 @@ type Inserter struct {
 // key from the path.
 //
 // It returns true if value was not present in target leaf's values.
-func (c Inserter) Insert(leaf *Leaf, path Path, value uint) bool {
-	_, ok := c.insert(leaf, path, value, true)
+func (c InserterOf[T]) Insert(leaf *LeafOf[T], path Path, value T) bool {
+	_, ok := c.insert(leaf, path, value, nil, true)
+	return ok
+}
+
+// InsertWithPayload is like Insert but also associates payload with inserted
+// value in the target leaf.
+func (c InserterOf[T]) InsertWithPayload(leaf *LeafOf[T], path Path, value T, payload any) bool {
+	_, ok := c.insert(leaf, path, value, payload, true)
 	return ok
 }
 
 // GetLeaf returns Leaf after given root by given path.
 // If path is empty root leaf is returned.
-func (c Inserter) GetLeaf(leaf *Leaf, path Path) *Leaf {
-	leaf, _ = c.insert(leaf, path, 0, false)
+func (c InserterOf[T]) GetLeaf(leaf *LeafOf[T], path Path) *LeafOf[T] {
+	var zero T
+	leaf, _ = c.insert(leaf, path, zero, nil, false)
 	return leaf
 }
 
-func (c Inserter) insert(leaf *Leaf, path Path, value uint, insert bool) (*Leaf, bool) {
+func (c InserterOf[T]) insert(leaf *LeafOf[T], path Path, value T, payload any, insert bool) (*LeafOf[T], bool) {
 	// First we should save the fixed order of nodes.
 	for _, key := range c.NodeOrder {
 		if val, ok := path.Get(key); ok {
@@ -261,14 +416,14 @@ func (c Inserter) insert(leaf *Leaf, path Path, value uint, insert bool) (*Leaf,
 		if !ok {
 			cur = path.Begin() // Reset cursor.
 
-			var bottomLeaf *Leaf
+			var bottomLeaf *LeafOf[T]
 			n = leaf.GetsertAny(
 				func() (key uint, ok bool) {
 					cur, key, ok = path.NextKey(cur)
 					return
 				},
-				func() (n *Node) {
-					n, bottomLeaf = c.makeTree(path, value, insert)
+				func() (n *NodeOf[T]) {
+					n, bottomLeaf = c.makeTree(leaf, path, value, payload, insert)
 					n.parent = leaf
 					return n
 				},
@@ -287,16 +442,67 @@ func (c Inserter) insert(leaf *Leaf, path Path, value uint, insert bool) (*Leaf,
 
 	var ok bool
 	if insert {
-		ok = leaf.Append(value)
+		ok = leaf.AppendWithPayload(value, payload)
 	}
 	return leaf, ok
 }
 
+// route returns pairs of path in order they are placed by insert starting
+// from the leaf. That is, it follows the existing nodes as insert does and
+// then places the rest of path as makeTree does. It does not change anything.
+// It also returns the target leaf if it already exists.
+func (c InserterOf[T]) route(leaf *LeafOf[T], path Path) (route []Pair, target *LeafOf[T]) {
+	route = make([]Pair, 0, path.Len())
+	follow := func(key uint, val []byte) {
+		route = append(route, Pair{key, val})
+		path = path.Without(key)
+		if leaf == nil {
+			return
+		}
+		if n := leaf.GetChild(key); n != nil {
+			leaf = n.GetLeaf(val)
+		} else {
+			leaf = nil
+		}
+	}
+	for _, key := range c.NodeOrder {
+		if val, ok := path.Get(key); ok {
+			follow(key, val)
+		}
+	}
+	for path.Len() > 0 {
+		var n *NodeOf[T]
+		if leaf != nil {
+			cur := path.Begin()
+			n, _ = leaf.GetAny(func() (key uint, ok bool) {
+				cur, key, ok = path.NextKey(cur)
+				return
+			})
+		}
+		if n == nil {
+			path.Ascend(path.Begin(), func(p Pair) bool {
+				route = append(route, p)
+				return true
+			})
+			return route, nil
+		}
+		v, _ := path.Get(n.key)
+		follow(n.key, v)
+	}
+	return route, leaf
+}
+
 // ForceInsert inserts value to the leaf that exists (or not and will be
 // created) at the given path starting with the leaf as root.
 //
 // Note that path is inserted as is, without any optimizations.
-func (c Inserter) ForceInsert(leaf *Leaf, pairs []Pair, value uint) {
+func (c InserterOf[T]) ForceInsert(leaf *LeafOf[T], pairs []Pair, value T) {
+	c.ForceInsertWithPayload(leaf, pairs, value, nil)
+}
+
+// ForceInsertWithPayload is like ForceInsert but also associates payload with
+// inserted value.
+func (c InserterOf[T]) ForceInsertWithPayload(leaf *LeafOf[T], pairs []Pair, value T, payload any) {
 	cb := c.IndexNode
 	for _, pair := range pairs {
 		n, inserted := leaf.GetsertChild(pair.Key)
@@ -305,18 +511,20 @@ func (c Inserter) ForceInsert(leaf *Leaf, pairs []Pair, value uint) {
 		}
 		leaf = n.GetsertLeaf(pair.Value)
 	}
-	leaf.Append(value)
+	leaf.AppendWithPayload(value, payload)
 }
 
-func (c Inserter) makeTree(p Path, v uint, insert bool) (topNode *Node, bottomLeaf *Leaf) {
+// makeTree makes a chain of nodes and leafs for the path to be added to the
+// leaf.
+func (c InserterOf[T]) makeTree(leaf *LeafOf[T], p Path, v T, payload any, insert bool) (topNode *NodeOf[T], bottomLeaf *LeafOf[T]) {
 	cur, last, ok := p.Last()
 	if !ok {
 		panic("could not make tree with empty path")
 	}
-	cn := &Node{key: last.Key}
+	cn := &NodeOf[T]{key: last.Key, cmp: leaf.cmp, kinds: leaf.kinds}
 	cl := cn.GetsertLeaf(last.Value)
 	if insert {
-		cl.Append(v)
+		cl.AppendWithPayload(v, payload)
 	}
 	bottomLeaf = cl
 
@@ -326,7 +534,7 @@ func (c Inserter) makeTree(p Path, v uint, insert bool) (topNode *Node, bottomLe
 	}
 
 	p.Descend(cur, func(p Pair) bool {
-		n := &Node{key: p.Key}
+		n := &NodeOf[T]{key: p.Key, cmp: leaf.cmp, kinds: leaf.kinds}
 		l := n.GetsertLeaf(p.Value)
 		l.AddChild(cn)
 
@@ -339,10 +547,3 @@ func (c Inserter) makeTree(p Path, v uint, insert bool) (topNode *Node, bottomLe
 
 	return cn, bottomLeaf
 }
-
-// Int implements the Item interface for integers.
-type btreeUint uint
-
-func (a btreeUint) Less(b btree.Item) bool {
-	return a < b.(btreeUint)
-}
@@ -0,0 +1,122 @@
+package radix
+
+// LeafArrayCapacity is a maximum number of items that Leaf stores in a sorted
+// array before switching to a BTree.
+const LeafArrayCapacity = 15
+
+// UintArrayCapacity is kept for compatibility.
+//
+// Deprecated: use LeafArrayCapacity.
+const UintArrayCapacity = LeafArrayCapacity
+
+// leafItem is an item stored in a Leaf with its optional payload.
+type leafItem[T any] struct {
+	value   T
+	payload any
+}
+
+// itemArray is a fixed capacity array of items sorted by value.
+// It does not store comparison function to stay small; the function is passed
+// to methods that need it instead.
+type itemArray[T any] struct {
+	data [LeafArrayCapacity]leafItem[T]
+	size int
+}
+
+// search returns index of x within array or index where x should be inserted.
+func (a *itemArray[T]) search(x T, cmp func(a, b T) int) (int, bool) {
+	l := 0
+	r := a.size
+	for l < r {
+		m := l + (r-l)/2
+		switch c := cmp(a.data[m].value, x); {
+		case c == 0:
+			return m, true
+		case c < 0:
+			l = m + 1
+		default:
+			r = m
+		}
+	}
+	return r, false
+}
+
+func (a *itemArray[T]) Has(x T, cmp func(a, b T) int) bool {
+	_, ok := a.search(x, cmp)
+	return ok
+}
+
+func (a *itemArray[T]) Get(x T, cmp func(a, b T) int) (ret leafItem[T], ok bool) {
+	i, ok := a.search(x, cmp)
+	if ok {
+		ret = a.data[i]
+	}
+	return ret, ok
+}
+
+// Upsert inserts item x into array or updates existing one.
+// It returns copy of itemArray, previous item (if were present) and a boolean
+// flag that reports about previous item replacement.
+//
+// Note that it will panic on out of range insertion.
+func (a itemArray[T]) Upsert(x leafItem[T], cmp func(a, b T) int) (cp itemArray[T], prev leafItem[T], replaced bool) {
+	i, has := a.search(x.value, cmp)
+	if has {
+		a.data[i], prev = x, a.data[i]
+		replaced = true
+	} else {
+		a.size++
+		copy(a.data[i+1:a.size], a.data[i:a.size-1])
+		a.data[i] = x
+	}
+	return a, prev, replaced
+}
+
+// Delete removes x from itemArray. It returns true when x was present and
+// removed.
+func (a itemArray[T]) Delete(x T, cmp func(a, b T) int) (cp itemArray[T], prev leafItem[T], removed bool) {
+	i, has := a.search(x, cmp)
+	if !has {
+		return a, prev, false
+	}
+	var zero leafItem[T]
+	a.size--
+	prev = a.data[i]
+	copy(a.data[i:a.size], a.data[i+1:a.size+1])
+	a.data[a.size] = zero
+	return a, prev, true
+}
+
+func (a *itemArray[T]) Ascend(cb func(x leafItem[T]) bool) bool {
+	for i := 0; i < a.size; i++ {
+		if !cb(a.data[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a itemArray[T]) Reset() itemArray[T] {
+	var zero leafItem[T]
+	for i := 0; i < a.size; i++ {
+		// Need to prevent memory leaks on complex structs.
+		a.data[i] = zero
+	}
+	a.size = 0
+	return a
+}
+
+func (a *itemArray[T]) AppendTo(p []T) []T {
+	for i := 0; i < a.size; i++ {
+		p = append(p, a.data[i].value)
+	}
+	return p
+}
+
+func (a *itemArray[T]) Len() int {
+	return a.size
+}
+
+func (a *itemArray[T]) Cap() int {
+	return LeafArrayCapacity
+}
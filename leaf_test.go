@@ -3,6 +3,8 @@ package radix
 import (
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -136,3 +138,20 @@ func seq(n int) []uint {
 	}
 	return ret
 }
+
+func TestLeafOfAscend(t *testing.T) {
+	leaf := NewLeafOf[string](nil, "", strings.Compare)
+	var exp []string
+	for i := LeafArrayCapacity * 2; i > 0; i-- {
+		exp = append(exp, fmt.Sprintf("%03d", i))
+		leaf.Append(fmt.Sprintf("%03d", i))
+	}
+	sort.Strings(exp)
+
+	if act := leaf.AppendTo(nil); !reflect.DeepEqual(act, exp) {
+		t.Errorf("leaf items are %v; want %v", act, exp)
+	}
+	if leaf.btree == nil {
+		t.Errorf("btree is nil")
+	}
+}
@@ -1,111 +1,206 @@
 package radix
 
-//go:generate ppgo
-
 import "sync"
 
-type Node struct {
+// Any is a value which matches any value of the key when stored in a path,
+// if the key is listed in TrieConfig.AnyKeys. That is, item inserted with
+// {5: Any} pair is found by lookups with any value of key 5 in the query.
+//
+// Any is not a valid UTF-8 string, thus it does not clash with textual
+// values. Values of keys which are not listed in TrieConfig.AnyKeys are
+// never treated as Any, thus such keys could hold arbitrary binary values.
+const Any = "\xff"
+
+// Node is a NodeOf uint items.
+type Node = NodeOf[uint]
+
+// NodeOf holds leafs of items of type T by their values for some key.
+type NodeOf[T any] struct {
 	mu sync.RWMutex
 
 	key    uint
-	values map[string]*Leaf
-	parent *Leaf
+	values treap[string, *LeafOf[T]]
+	parent *LeafOf[T]
+
+	// cmp and kinds are passed to the leafs created within the node.
+	cmp   func(a, b T) int
+	kinds *keyKinds
+
+	// matcher indexes values of the node if its key has a kind. It is built
+	// when the first value is added.
+	matcher matcher
 }
 
-func (n *Node) Key() uint {
+func (n *NodeOf[T]) Key() uint {
 	return n.key
 }
 
-func (n *Node) Parent() *Leaf {
+func (n *NodeOf[T]) Parent() *LeafOf[T] {
 	return n.parent
 }
 
-func (n *Node) LeafCount() int {
+// leafs returns leafs of n by their values. Returned map is not changed by
+// further mutations of n.
+func (n *NodeOf[T]) leafs() (ret treap[string, *LeafOf[T]]) {
 	n.mu.RLock()
-	defer n.mu.RUnlock()
-	return len(n.values)
+	ret = n.values
+	n.mu.RUnlock()
+	return
 }
 
-func (n *Node) AscendLeafs(it func(string, *Leaf) bool) bool {
-	n.mu.RLock()
-	defer n.mu.RUnlock()
-	for k, l := range n.values {
-		if !it(k, l) {
-			return false
-		}
-	}
-	return true
+func (n *NodeOf[T]) LeafCount() int {
+	return n.leafs().Len()
 }
 
-func (n *Node) HasLeaf(k []byte) (ok bool) {
-	n.mu.RLock()
-	_, ok = n.values[string(k)]
-	n.mu.RUnlock()
+// AscendLeafs calls it for every leaf of n in ascending order of their values.
+func (n *NodeOf[T]) AscendLeafs(it func(string, *LeafOf[T]) bool) bool {
+	return n.leafs().Ascend(it)
+}
+
+func (n *NodeOf[T]) HasLeaf(k []byte) (ok bool) {
+	_, ok = n.leafs().Get(string(k))
 	return
 }
 
-func (n *Node) GetLeaf(k []byte) (ret *Leaf) {
-	n.mu.RLock()
-	ret = n.values[string(k)]
-	n.mu.RUnlock()
+func (n *NodeOf[T]) GetLeaf(k []byte) (ret *LeafOf[T]) {
+	ret, _ = n.leafs().Get(string(k))
 	return
 }
 
-func (n *Node) GetsertLeaf(k []byte) (ret *Leaf) {
-	var ok bool
-	n.mu.Lock()
-	ret, ok = n.values[string(k)]
-	if ok {
+// isAny reports whether stored value v of n matches any query value.
+func (n *NodeOf[T]) isAny(v string) bool {
+	return v == Any && n.kinds.matchesAny(n.key)
+}
+
+// anyLeaf returns leaf of values which matches any query value.
+func (n *NodeOf[T]) anyLeaf(values treap[string, *LeafOf[T]]) *LeafOf[T] {
+	if !n.kinds.matchesAny(n.key) {
+		return nil
+	}
+	wildcard, _ := values.Get(Any)
+	return wildcard
+}
+
+// AscendMatch calls it for every leaf of n which value matches query value
+// k. That is, the leaf with value k and the leaf with Any value if the key of
+// n is listed in TrieConfig.AnyKeys. If node key has a kind, leafs are
+// matched as the kind describes.
+func (n *NodeOf[T]) AscendMatch(k []byte, it func(*LeafOf[T]) bool) bool {
+	if kind := n.kinds.kind(n.key); kind != nil {
+		return n.ascendMatcher(kind, k, it)
+	}
+	values := n.leafs()
+	exact, _ := values.Get(string(k))
+	wildcard := n.anyLeaf(values)
+	if exact != nil && !it(exact) {
+		return false
+	}
+	if wildcard != nil && wildcard != exact {
+		return it(wildcard)
+	}
+	return true
+}
+
+func (n *NodeOf[T]) ascendMatcher(kind KeyKind, k []byte, it func(*LeafOf[T]) bool) bool {
+	n.mu.RLock()
+	if n.matcher == nil {
+		// Node was made without GetsertLeaf() calls, e.g. by Build().
+		n.mu.RUnlock()
+		n.mu.Lock()
+		if n.matcher == nil {
+			n.buildMatcher(kind)
+		}
 		n.mu.Unlock()
-		return
+		n.mu.RLock()
 	}
-	if n.values == nil {
-		n.values = make(map[string]*Leaf, 1)
+	m, values := n.matcher, n.values
+	n.mu.RUnlock()
+
+	ok := m.match(k, func(v string) bool {
+		l, _ := values.Get(v)
+		return it(l)
+	})
+	if !ok {
+		return false
 	}
+	if wildcard := n.anyLeaf(values); wildcard != nil {
+		return it(wildcard)
+	}
+	return true
+}
 
-	cp := string(k)
-	ret = NewLeaf(n, cp)
-	n.values[cp] = ret
+func (n *NodeOf[T]) buildMatcher(kind KeyKind) {
+	m := kind.newMatcher()
+	n.values.Ascend(func(v string, _ *LeafOf[T]) bool {
+		if !n.isAny(v) {
+			m = m.add(v)
+		}
+		return true
+	})
+	n.matcher = m
+}
 
-	n.mu.Unlock()
-	return
+// addValue and removeValue keep matcher in sync with values. They must be
+// called with n.mu held for writing.
+func (n *NodeOf[T]) addValue(v string) {
+	kind := n.kinds.kind(n.key)
+	switch {
+	case kind == nil || n.isAny(v):
+	case n.matcher == nil:
+		n.buildMatcher(kind)
+	default:
+		n.matcher = n.matcher.add(v)
+	}
 }
 
-func (n *Node) GetsertLeafStr(k string) (ret *Leaf) {
+func (n *NodeOf[T]) removeValue(v string) {
+	if n.matcher != nil && !n.isAny(v) {
+		n.matcher = n.matcher.remove(v)
+	}
+}
+
+func (n *NodeOf[T]) GetsertLeaf(k []byte) (ret *LeafOf[T]) {
+	if ret = n.GetLeaf(k); ret != nil {
+		return ret
+	}
+	return n.GetsertLeafStr(string(k))
+}
+
+func (n *NodeOf[T]) GetsertLeafStr(k string) (ret *LeafOf[T]) {
 	var ok bool
 	n.mu.Lock()
-	ret, ok = n.values[k]
+	ret, ok = n.values.Get(k)
 	if ok {
 		n.mu.Unlock()
 		return
 	}
-	if n.values == nil {
-		n.values = make(map[string]*Leaf, 1)
-	}
 
-	ret = NewLeaf(n, k)
-	n.values[k] = ret
+	ret = NewLeafOf(n, k, n.cmp)
+	n.values = n.values.Set(k, ret)
+	n.addValue(k)
 
 	n.mu.Unlock()
 	return
 }
 
-func (n *Node) DeleteLeaf(k []byte) *Leaf {
+func (n *NodeOf[T]) DeleteLeaf(k []byte) *LeafOf[T] {
 	n.mu.Lock()
-	ret, ok := n.values[string(k)]
+	values, ret, ok := n.values.Delete(string(k))
 	if ok {
-		delete(n.values, string(k))
+		n.values = values
+		n.removeValue(string(k))
 		ret.parent = nil
 	}
 	n.mu.Unlock()
 	return ret
 }
 
-func (n *Node) DeleteEmptyLeaf(k string) (leaf *Leaf, ok bool) {
+func (n *NodeOf[T]) DeleteEmptyLeaf(k string) (leaf *LeafOf[T], ok bool) {
 	n.mu.Lock()
-	leaf, has := n.values[string(k)]
+	leaf, has := n.values.Get(k)
 	if has && leaf.Empty() {
-		delete(n.values, string(k))
+		n.values, _, _ = n.values.Delete(k)
+		n.removeValue(k)
 		leaf.parent = nil
 		ok = true
 	}
@@ -113,9 +208,6 @@ func (n *Node) DeleteEmptyLeaf(k string) (leaf *Leaf, ok bool) {
 	return
 }
 
-func (n *Node) Empty() (ok bool) {
-	n.mu.RLock()
-	ok = len(n.values) == 0
-	n.mu.RUnlock()
-	return
+func (n *NodeOf[T]) Empty() bool {
+	return n.leafs().Len() == 0
 }
@@ -4,6 +4,7 @@ package radix
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"sync"
 )
@@ -316,6 +317,31 @@ func (a Path) Equal(b Path) bool {
 	return true
 }
 
+// pathKey returns string that uniquely identifies set of pairs of p.
+func pathKey(p Path) string {
+	var buf []byte
+	p.Ascend(p.Begin(), func(pair Pair) bool {
+		buf = binary.AppendUvarint(buf, uint64(pair.Key))
+		buf = binary.AppendUvarint(buf, uint64(len(pair.Value)))
+		buf = append(buf, pair.Value...)
+		return true
+	})
+	return string(buf)
+}
+
+// clonePath returns deep copy of p's included pairs.
+func clonePath(p Path) Path {
+	pairs := make([]Pair, 0, p.Len())
+	p.Ascend(p.Begin(), func(pair Pair) bool {
+		pairs = append(pairs, Pair{
+			Key:   pair.Key,
+			Value: append([]byte(nil), pair.Value...),
+		})
+		return true
+	})
+	return PathFromSliceBorrow(pairs)
+}
+
 func (p Path) includes(i int) bool {
 	return p.excluded&(1<<uint(i)) == 0
 }
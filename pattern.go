@@ -0,0 +1,167 @@
+package radix
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+)
+
+// Regexp is a KeyKind of regular expressions in the syntax of the regexp
+// package, like "Mozilla/5\.0 .*".
+//
+// Stored pattern matches query value if it matches the whole value. Stored
+// values which are not valid patterns are matched by equality.
+type Regexp struct{}
+
+func (Regexp) newMatcher() matcher {
+	return newPatternIndex(func(p string) string {
+		return p
+	})
+}
+
+// Glob is a KeyKind of shell-like patterns, like "Mozilla/*". Pattern symbol
+// '*' matches any sequence of characters, '?' matches any single character
+// and '\' escapes the following character.
+//
+// Stored pattern matches query value if it matches the whole value.
+type Glob struct{}
+
+func (Glob) newMatcher() matcher {
+	return newPatternIndex(globRegexp)
+}
+
+// globRegexp returns regular expression matching the same strings as glob.
+func globRegexp(glob string) string {
+	var sb strings.Builder
+	sb.WriteString(`(?s:`)
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case c == '*':
+			sb.WriteString(`.*`)
+		case c == '?':
+			sb.WriteString(`.`)
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	sb.WriteString(`)`)
+	return sb.String()
+}
+
+// patternIndex holds patterns compiled once they are added. Patterns are
+// grouped by literal prefix every match must begin with, so only patterns
+// which prefix is a prefix of the query value are evaluated.
+type patternIndex struct {
+	// expr returns regular expression of the pattern.
+	expr func(string) string
+
+	// prefixes maps literal prefixes to the patterns.
+	// maxPrefix is the length of the longest one.
+	prefixes  treap[string, []pattern]
+	maxPrefix int
+
+	// values maps patterns to their literal prefixes.
+	values treap[string, string]
+
+	// other holds values which are not valid patterns.
+	other treap[string, struct{}]
+}
+
+type pattern struct {
+	value string
+	re    *regexp.Regexp
+}
+
+func newPatternIndex(expr func(string) string) *patternIndex {
+	return &patternIndex{
+		expr: expr,
+	}
+}
+
+// compilePattern compiles expr to match whole values. It also returns literal
+// string every match of expr must begin with.
+func compilePattern(expr string) (re *regexp.Regexp, prefix string, err error) {
+	// Prefix is taken from the unanchored expression, as regexp does not
+	// report it for anchored ones which are not one-pass.
+	sre, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, "", err
+	}
+	prog, err := syntax.Compile(sre.Simplify())
+	if err != nil {
+		return nil, "", err
+	}
+	prefix, _ = prog.Prefix()
+	re, err = regexp.Compile(`^(?:` + expr + `)$`)
+	if err != nil {
+		return nil, "", err
+	}
+	return re, prefix, nil
+}
+
+func (x *patternIndex) add(v string) matcher {
+	_, has := x.values.Get(v)
+	if _, other := x.other.Get(v); has || other {
+		return x
+	}
+	cp := *x
+	re, prefix, err := compilePattern(x.expr(v))
+	if err != nil {
+		cp.other = x.other.Set(v, struct{}{})
+		return &cp
+	}
+	// Slices are shared with other versions of the index, thus never
+	// appended in place.
+	ps, _ := x.prefixes.Get(prefix)
+	cp.prefixes = x.prefixes.Set(prefix, append(slices.Clip(ps), pattern{v, re}))
+	cp.values = x.values.Set(v, prefix)
+	cp.maxPrefix = max(x.maxPrefix, len(prefix))
+	return &cp
+}
+
+func (x *patternIndex) remove(v string) matcher {
+	cp := *x
+	values, prefix, has := x.values.Delete(v)
+	if !has {
+		cp.other, _, _ = x.other.Delete(v)
+		return &cp
+	}
+	cp.values = values
+	ps, _ := x.prefixes.Get(prefix)
+	ps = slices.DeleteFunc(slices.Clone(ps), func(p pattern) bool {
+		return p.value == v
+	})
+	if len(ps) == 0 {
+		cp.prefixes, _, _ = x.prefixes.Delete(prefix)
+	} else {
+		cp.prefixes = x.prefixes.Set(prefix, ps)
+	}
+	return &cp
+}
+
+func (x *patternIndex) match(q []byte, it func(string) bool) bool {
+	if _, ok := x.other.Get(string(q)); ok && !it(string(q)) {
+		return false
+	}
+	return x.candidates(q, func(p pattern) bool {
+		return !p.re.Match(q) || it(p.value)
+	})
+}
+
+// candidates calls it for every pattern which literal prefix is a prefix of
+// q. Other patterns could not match q.
+func (x *patternIndex) candidates(q []byte, it func(pattern) bool) bool {
+	for i := 0; i <= len(q) && i <= x.maxPrefix; i++ {
+		ps, _ := x.prefixes.Get(string(q[:i]))
+		for _, p := range ps {
+			if !it(p) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,288 @@
+package radix
+
+import "reflect"
+
+// Snapshot returns read-only copy of the trie. Snapshot is not affected by
+// further mutations of the trie and could be read without any trie-wide
+// locking. Its mutation methods panic.
+//
+// For persistent trie (see TrieConfig.Persistent) Snapshot takes O(1) time
+// and memory: snapshot shares leafs and nodes with the trie, and they are
+// reclaimed by the garbage collector once neither the trie nor the snapshot
+// refers them. For other tries Snapshot makes a deep copy while mutations are
+// blocked.
+func (t *TrieOf[T]) Snapshot() *TrieOf[T] {
+	s := &TrieOf[T]{
+		inserter:   t.inserter,
+		persistent: true,
+		readonly:   true,
+	}
+	if !t.persistent {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+	}
+	if t.index != nil {
+		t.index.mu.Lock()
+		defer t.index.mu.Unlock()
+		s.index = t.index.clone()
+	}
+	root := t.root.Load()
+	if !t.persistent {
+		root = cloneTree(root, nil)
+	}
+	s.root.Store(root)
+	return s
+}
+
+// cow holds copy-on-write mutation of the trie. Leafs and nodes that
+// are created or copied by cow are owned by it and are changed in place until
+// the root is published to readers.
+type cow[T any] struct {
+	root     *LeafOf[T]
+	inserter *InserterOf[T]
+	owned    map[any]struct{}
+}
+
+func newCow[T any](root *LeafOf[T], inserter *InserterOf[T]) *cow[T] {
+	return &cow[T]{
+		root:     root,
+		inserter: inserter,
+	}
+}
+
+// adopt makes owned leafs and nodes the parents of their children. It must be
+// called before the root is published for non-persistent trie, which relies
+// on parent references to find paths of leafs and to remove empty ones.
+func (c *cow[T]) adopt() {
+	for x := range c.owned {
+		switch x := x.(type) {
+		case *LeafOf[T]:
+			x.AscendChildren(func(n *NodeOf[T]) bool {
+				n.parent = x
+				return true
+			})
+		case *NodeOf[T]:
+			x.values.Ascend(func(_ string, l *LeafOf[T]) bool {
+				l.parent = x
+				return true
+			})
+		}
+	}
+}
+
+// mustRoot panics if leaf is not nil and is not a root leaf.
+func (c *cow[T]) mustRoot(leaf *LeafOf[T]) {
+	if leaf != nil && leaf.parent != nil {
+		panic("radix: persistent trie could be mutated only from the root")
+	}
+}
+
+func (c *cow[T]) insert(p Path, v T, payload any) bool {
+	route, target := c.inserter.route(c.root, p)
+	if target != nil {
+		if old, has := target.Payload(v); has && samePayload(old, payload) {
+			// Nothing is changed, thus nothing is copied.
+			return false
+		}
+	}
+	leafs := c.descend(route)
+	return leafs[len(leafs)-1].AppendWithPayload(v, payload)
+}
+
+// samePayload reports whether payloads a and b are equal. Payloads which are
+// not comparable are never equal.
+func samePayload(a, b any) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.ValueOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// delete removes v from every leaf found by strict lookup of p. If exact is
+// true, only the leaf with exactly path p is considered. It calls removed
+// with path of every leaf v was removed from and the leaf itself.
+func (c *cow[T]) delete(p Path, v T, exact bool, removed func(Path, *LeafOf[T])) (payload any, ok bool) {
+	var routes [][]Pair
+	traceLookup(c.root, p, nil, func(route []Pair, leaf *LeafOf[T]) {
+		if exact && len(route) != p.Len() {
+			return
+		}
+		if _, has := leaf.Payload(v); has {
+			routes = append(routes, append([]Pair(nil), route...))
+		}
+	})
+	for _, route := range routes {
+		leafs := c.descend(route)
+		leaf := leafs[len(leafs)-1]
+		payload, _ = leaf.Payload(v)
+		leaf.Remove(v)
+		ok = true
+		removed(PathFromSlice(route), leaf)
+		c.cleanup(route, leafs)
+	}
+	return payload, ok
+}
+
+// descend makes every leaf and node on the route from the root owned by c,
+// copying existing ones and creating missing ones. It returns owned leafs
+// from the root to the end of the route.
+//
+// Note that copying of a node takes time proportional to the number of its
+// leafs.
+func (c *cow[T]) descend(route []Pair) []*LeafOf[T] {
+	c.root = c.ownLeaf(c.root)
+
+	leaf := c.root
+	leafs := make([]*LeafOf[T], 1, len(route)+1)
+	leafs[0] = leaf
+	for _, pair := range route {
+		n := leaf.GetChild(pair.Key)
+		if n == nil {
+			n = &NodeOf[T]{
+				key:   pair.Key,
+				cmp:   leaf.cmp,
+				kinds: leaf.kinds,
+			}
+			c.own(n)
+			if c.inserter.IndexNode != nil {
+				c.inserter.IndexNode(n)
+			}
+		} else {
+			n = c.ownNode(n)
+		}
+		n.parent = leaf
+		leaf.putChild(n)
+
+		k := string(pair.Value)
+		child, _ := n.values.Get(k)
+		if child == nil {
+			child = NewLeafOf(n, k, n.cmp)
+			c.own(child)
+		} else {
+			child = c.ownLeaf(child)
+			child.parent = n
+		}
+		n.values = n.values.Set(k, child)
+		n.addValue(k)
+
+		leaf = child
+		leafs = append(leafs, leaf)
+	}
+	return leafs
+}
+
+// cleanup removes empty leafs and nodes on the route bottom-top as
+// cleanupBottomTop does. Leafs must be the result of descend(route).
+func (c *cow[T]) cleanup(route []Pair, leafs []*LeafOf[T]) {
+	for i := len(route); i > 0 && leafs[i].Empty(); i-- {
+		pair := route[i-1]
+		n := leafs[i-1].GetChild(pair.Key)
+		n.values, _, _ = n.values.Delete(string(pair.Value))
+		n.removeValue(string(pair.Value))
+		if n.values.Len() > 0 {
+			return
+		}
+		leafs[i-1].RemoveChild(n.key)
+	}
+}
+
+func (c *cow[T]) own(x any) {
+	if c.owned == nil {
+		c.owned = make(map[any]struct{})
+	}
+	c.owned[x] = struct{}{}
+}
+
+func (c *cow[T]) owns(x any) bool {
+	_, ok := c.owned[x]
+	return ok
+}
+
+func (c *cow[T]) ownLeaf(l *LeafOf[T]) *LeafOf[T] {
+	if c.owns(l) {
+		return l
+	}
+	cp := copyLeaf(l)
+	c.own(cp)
+	return cp
+}
+
+func (c *cow[T]) ownNode(n *NodeOf[T]) *NodeOf[T] {
+	if c.owns(n) {
+		return n
+	}
+	cp := copyNode(n)
+	c.own(cp)
+	return cp
+}
+
+// traceLookup is like Lookup with strict strategy, but also passes route
+// from lf to every found leaf. Route is only valid until it returns.
+func traceLookup[T any](lf *LeafOf[T], query Path, route []Pair, it func([]Pair, *LeafOf[T])) {
+	if query.Len() == 0 {
+		it(route, lf)
+		return
+	}
+	min, max := query.KeyRange()
+	lf.AscendChildrenRange(min, max, func(n *NodeOf[T]) bool {
+		if v, ok := query.Get(n.key); ok {
+			if leaf := n.GetLeaf(v); leaf != nil {
+				traceLookup(leaf, query.Without(n.key), append(route, Pair{n.key, v}), it)
+			}
+		}
+		return true
+	})
+}
+
+// copyLeaf returns shallow copy of l. That is, items and child nodes are
+// shared with l until any of them is changed.
+func copyLeaf[T any](l *LeafOf[T]) *LeafOf[T] {
+	cp := NewLeafOf(l.parent, l.value, l.cmp)
+	cp.kinds = l.kinds
+	l.dmu.RLock()
+	cp.array = l.array
+	if l.btree != nil {
+		cp.btree = l.btree.Clone()
+	}
+	l.dmu.RUnlock()
+	cp.children.Store(l.children.Load())
+	return cp
+}
+
+// copyNode returns shallow copy of n. That is, leafs and matcher are shared
+// with n.
+func copyNode[T any](n *NodeOf[T]) *NodeOf[T] {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	cp := &NodeOf[T]{
+		key:     n.key,
+		parent:  n.parent,
+		cmp:     n.cmp,
+		kinds:   n.kinds,
+		values:  n.values,
+		matcher: n.matcher,
+	}
+	return cp
+}
+
+// cloneTree returns deep copy of the tree starting at l.
+func cloneTree[T any](l *LeafOf[T], parent *NodeOf[T]) *LeafOf[T] {
+	cp := copyLeaf(l)
+	cp.parent = parent
+	var nodes treap[uint, *NodeOf[T]]
+	cp.AscendChildren(func(n *NodeOf[T]) bool {
+		n = copyNode(n)
+		n.parent = cp
+		n.values.Ascend(func(k string, child *LeafOf[T]) bool {
+			n.values = n.values.Set(k, cloneTree(child, n))
+			return true
+		})
+		nodes = nodes.Set(n.key, n)
+		return true
+	})
+	cp.setNodes(nodes)
+	return cp
+}
@@ -0,0 +1,179 @@
+package radix_test
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+
+	. "github.com/gobwas/radix"
+	"github.com/gobwas/radix/listing"
+)
+
+func TestTriePersistent(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config TrieConfig
+	}{
+		{"default", TrieConfig{}},
+		{"order", TrieConfig{NodeOrder: []uint{3, 1}}},
+		{"index", TrieConfig{ReverseIndex: true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			exp := New(&config)
+			config.Persistent = true
+			act := New(&config)
+
+			entries := randEntries(300)
+			for i, e := range entries {
+				d := entries[rand.Intn(i+1)]
+				for _, trie := range []*Trie{exp, act} {
+					trie.InsertWithPayload(e.Path, e.Item, e.Payload)
+					if i%3 == 0 {
+						trie.Delete(d.Path, d.Item)
+					}
+				}
+			}
+			for _, e := range entries[:50] {
+				p := PathFromMapStr(map[uint]string{7: "moved"})
+				if a, b := act.Move(e.Path, p, e.Item), exp.Move(e.Path, p, e.Item); a != b {
+					t.Fatalf("Move() = %t; want %t", a, b)
+				}
+			}
+
+			if a, b := trieItems(act), trieItems(exp); !reflect.DeepEqual(a, b) {
+				t.Fatalf(
+					"persistent trie items = %v; want %v\nTrie:\n%s",
+					a, b, listing.DumpString(act),
+				)
+			}
+			for _, e := range entries {
+				a := selectItems(act, e.Path)
+				b := selectItems(exp, e.Path)
+				if !reflect.DeepEqual(a, b) {
+					t.Fatalf("SelectGreedy(%v) = %v; want %v", e.Path, a, b)
+				}
+			}
+			al, an := act.SizeOf(Path{})
+			bl, bn := exp.SizeOf(Path{})
+			if al != bl || an != bn {
+				t.Errorf("SizeOf() = %d, %d; want %d, %d", al, an, bl, bn)
+			}
+			if config.ReverseIndex {
+				for v := uint(0); v < 10; v++ {
+					if a, b := pathStrings(act.PathsOf(v)), pathStrings(exp.PathsOf(v)); !reflect.DeepEqual(a, b) {
+						t.Errorf("PathsOf(%d) = %v; want %v", v, a, b)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTrieSnapshot(t *testing.T) {
+	for _, persistent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("persistent=%t", persistent), func(t *testing.T) {
+			trie := New(&TrieConfig{
+				Persistent:   persistent,
+				ReverseIndex: true,
+			})
+			entries := randEntries(100)
+			for _, e := range entries {
+				trie.InsertWithPayload(e.Path, e.Item, e.Payload)
+			}
+			exp := trieItems(trie)
+			snap := trie.Snapshot()
+
+			for _, e := range entries[:50] {
+				trie.Delete(e.Path, e.Item)
+			}
+			for _, e := range randEntries(100) {
+				trie.InsertWithPayload(e.Path, e.Item+100, e.Payload)
+			}
+			trie.DeleteItem(entries[50].Item)
+
+			if act := trieItems(snap); !reflect.DeepEqual(act, exp) {
+				t.Errorf("snapshot items changed after trie mutations:\n%v\nwant:\n%v", act, exp)
+			}
+			if ps := snap.PathsOf(entries[50].Item); len(ps) == 0 {
+				t.Errorf("snapshot PathsOf() is empty after trie DeleteItem()")
+			}
+			if act := trieItems(snap.Snapshot()); !reflect.DeepEqual(act, exp) {
+				t.Errorf("snapshot of snapshot items = %v; want %v", act, exp)
+			}
+
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("no panic on snapshot mutation")
+					}
+				}()
+				snap.Insert(Path{}, 1)
+			}()
+		})
+	}
+}
+
+func TestTrieSnapshotConcurrent(t *testing.T) {
+	trie := New(&TrieConfig{Persistent: true})
+	for i := 0; i < 100; i++ {
+		trie.Insert(PathFromMapStr(map[uint]string{1: "a", 2: fmt.Sprint(i % 10)}), uint(i))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 100; i < 1000; i++ {
+			p := PathFromMapStr(map[uint]string{1: "a", 2: fmt.Sprint(i % 10)})
+			x := trie.Txn()
+			x.Insert(p, uint(i))
+			x.Delete(PathFromMapStr(map[uint]string{1: "a", 2: fmt.Sprint(i % 10)}), uint(i-100))
+			if err := x.Commit(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				var n int
+				trie.Snapshot().Walk(Path{}, VisitorFunc(
+					func(_ []PairStr, l *Leaf) bool {
+						n += l.ItemCount()
+						return true
+					},
+					nil,
+				))
+				if n != 100 {
+					t.Errorf("snapshot has %d items; want 100", n)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func trieItems(trie *Trie) map[string]int {
+	m := map[string]int{}
+	trie.ForEach(Path{}, func(trace []PairStr, v uint) bool {
+		m[fmt.Sprint(PathFromSliceStr(trace), v)]++
+		return true
+	})
+	return m
+}
+
+func selectItems(trie *Trie, query Path) map[uint]int {
+	m := map[uint]int{}
+	trie.SelectGreedy(query, nil, func(_ Wildcard, v uint) bool {
+		m[v]++
+		return true
+	})
+	return m
+}
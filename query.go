@@ -0,0 +1,493 @@
+package radix
+
+import (
+	"fmt"
+	"math/bits"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Query is a set of conditions on values of path keys. Unlike Path, which
+// only holds equality conditions, Query could also express conditions like
+// "value of key is not equal to v", "value of key is one of v1, v2" or "value
+// of key starts with p".
+//
+// Query is immutable: methods adding conditions return a modified copy.
+type Query struct {
+	conds []cond
+	done  uint32 // Bitmask of satisfied conds.
+}
+
+// cond holds all conditions on values of a single key.
+type cond struct {
+	key uint
+
+	// eq holds sorted allowed values if fixed is true. Empty eq with fixed
+	// set matches nothing.
+	eq    []string
+	fixed bool
+
+	// ne holds excluded values.
+	ne []string
+
+	// prefixes and patterns hold prefixes and regular expressions every
+	// matching value must have.
+	prefixes []string
+	patterns []*regexp.Regexp
+
+	// required is true if item's path must have the key even for greedy
+	// lookups. absent is true if item's path must not have the key.
+	// optional is true if conditions hold only when the path has the key.
+	required bool
+	absent   bool
+	optional bool
+}
+
+// NewQuery returns query which requires values of the keys to be equal to
+// values of p.
+func NewQuery(p Path) Query {
+	var q Query
+	p.Ascend(p.Begin(), func(pair Pair) bool {
+		q = q.Equal(pair.Key, pair.Value)
+		return true
+	})
+	return q
+}
+
+// Equal returns a copy of q which also requires value of key to be equal to
+// value.
+func (q Query) Equal(key uint, value []byte) Query {
+	return q.In(key, value)
+}
+
+// In returns a copy of q which also requires value of key to be equal to one
+// of values. Lookups fan out over all listed values of a node at once, so
+// every matching item is reported only once.
+//
+// Calling In multiple times for the same key leaves only values listed in
+// every call.
+func (q Query) In(key uint, values ...[]byte) Query {
+	return q.with(key, func(c *cond) {
+		set := make([]string, 0, len(values))
+		for _, v := range values {
+			set = append(set, string(v))
+		}
+		slices.Sort(set)
+		set = slices.Compact(set)
+		if c.fixed {
+			set = slices.DeleteFunc(set, func(v string) bool {
+				_, ok := slices.BinarySearch(c.eq, v)
+				return !ok
+			})
+		}
+		c.eq = set
+		c.fixed = true
+	})
+}
+
+// NotEqual returns a copy of q which also requires value of key to be not
+// equal to value.
+func (q Query) NotEqual(key uint, value []byte) Query {
+	return q.with(key, func(c *cond) {
+		if v := string(value); !slices.Contains(c.ne, v) {
+			c.ne = append(c.ne, v)
+		}
+	})
+}
+
+// Prefix returns a copy of q which also requires value of key to start with
+// prefix.
+func (q Query) Prefix(key uint, prefix []byte) Query {
+	return q.with(key, func(c *cond) {
+		if p := string(prefix); !slices.Contains(c.prefixes, p) {
+			c.prefixes = append(c.prefixes, p)
+		}
+	})
+}
+
+// Match returns a copy of q which also requires value of key to match re.
+func (q Query) Match(key uint, re *regexp.Regexp) Query {
+	return q.with(key, func(c *cond) {
+		c.patterns = append(c.patterns, re)
+	})
+}
+
+// HasKey returns a copy of q which also requires item's path to have key with
+// any value. Unlike other conditions, it is also checked by greedy lookups.
+func (q Query) HasKey(key uint) Query {
+	return q.with(key, func(c *cond) {
+		c.required = true
+	})
+}
+
+// LacksKey returns a copy of q which requires item's path to not have key.
+// Other conditions on key are ignored.
+func (q Query) LacksKey(key uint) Query {
+	return q.with(key, func(c *cond) {
+		c.absent = true
+	})
+}
+
+// Optional returns a copy of q where conditions on key must hold only if
+// item's path has the key. That is, items which paths do not have the key
+// match q as well.
+//
+// Unlike other keys of the query, strict lookups do not stop at the leaf
+// when only optional keys are left, but also follow the nodes of optional
+// keys below it.
+func (q Query) Optional(key uint) Query {
+	return q.with(key, func(c *cond) {
+		c.optional = true
+	})
+}
+
+// Len returns number of keys having conditions which are not satisfied yet.
+// Keys which are optional or required to be absent are not counted.
+func (q Query) Len() int {
+	n := len(q.conds) - bits.OnesCount32(q.done)
+	q.ascend(func(_ int, c *cond) bool {
+		if c.absent || c.optional {
+			n--
+		}
+		return true
+	})
+	return n
+}
+
+// follow reports whether q has conditions on keys which nodes must be
+// followed. Unlike Len(), it also counts optional keys.
+func (q Query) follow() bool {
+	var ok bool
+	q.ascend(func(_ int, c *cond) bool {
+		ok = !c.absent
+		return !ok
+	})
+	return ok
+}
+
+// hasKeys reports whether all HasKey conditions of q are satisfied.
+func (q Query) hasKeys() bool {
+	ok := true
+	q.ascend(func(_ int, c *cond) bool {
+		ok = !c.required || c.absent
+		return ok
+	})
+	return ok
+}
+
+func (q Query) String() string {
+	var sb strings.Builder
+	q.ascend(func(_ int, c *cond) bool {
+		if c.fixed {
+			fmt.Fprintf(&sb, "%#x:%s; ", c.key, strings.Join(c.eq, "|"))
+		}
+		for _, v := range c.ne {
+			fmt.Fprintf(&sb, "%#x:!%s; ", c.key, v)
+		}
+		for _, p := range c.prefixes {
+			fmt.Fprintf(&sb, "%#x:^%s; ", c.key, p)
+		}
+		for _, re := range c.patterns {
+			fmt.Fprintf(&sb, "%#x:~%s; ", c.key, re)
+		}
+		switch {
+		case c.absent:
+			fmt.Fprintf(&sb, "%#x:!*; ", c.key)
+		case c.required:
+			fmt.Fprintf(&sb, "%#x:*; ", c.key)
+		case c.optional:
+			fmt.Fprintf(&sb, "%#x:?; ", c.key)
+		}
+		return true
+	})
+	return sb.String()
+}
+
+func (q Query) with(key uint, fn func(*cond)) Query {
+	i := sort.Search(len(q.conds), func(i int) bool {
+		return q.conds[i].key >= key
+	})
+	conds := slices.Clone(q.conds)
+	if i == len(conds) || conds[i].key != key {
+		if len(conds) == MaxPathSize {
+			panic("query is full")
+		}
+		conds = slices.Insert(conds, i, cond{key: key})
+		// Shift bits of satisfied conditions to keep them aligned with conds.
+		lo := q.done & (1<<uint(i) - 1)
+		q.done = lo | (q.done&^lo)<<1
+	}
+	c := conds[i]
+	c.eq = slices.Clip(c.eq)
+	c.ne = slices.Clip(c.ne)
+	c.prefixes = slices.Clip(c.prefixes)
+	c.patterns = slices.Clip(c.patterns)
+	fn(&c)
+	conds[i] = c
+	q.conds = conds
+	return q
+}
+
+// get returns index of not yet satisfied condition on key.
+func (q Query) get(key uint) (int, bool) {
+	i := sort.Search(len(q.conds), func(i int) bool {
+		return q.conds[i].key >= key
+	})
+	if i == len(q.conds) || q.conds[i].key != key || q.done&(1<<uint(i)) != 0 {
+		return -1, false
+	}
+	return i, true
+}
+
+func (q Query) without(i int) Query {
+	q.done |= 1 << uint(i)
+	return q
+}
+
+func (q Query) ascend(it func(int, *cond) bool) {
+	for i := range q.conds {
+		if q.done&(1<<uint(i)) == 0 && !it(i, &q.conds[i]) {
+			return
+		}
+	}
+}
+
+func (q Query) keyRange() (min, max uint) {
+	first := true
+	q.ascend(func(_ int, c *cond) bool {
+		if first {
+			min, first = c.key, false
+		}
+		max = c.key
+		return true
+	})
+	return min, max
+}
+
+func (c *cond) match(v string) bool {
+	if c.fixed {
+		if _, ok := slices.BinarySearch(c.eq, v); !ok {
+			return false
+		}
+	}
+	if slices.Contains(c.ne, v) {
+		return false
+	}
+	for _, p := range c.prefixes {
+		if !strings.HasPrefix(v, p) {
+			return false
+		}
+	}
+	for _, re := range c.patterns {
+		if !re.MatchString(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// single reports whether c matches exactly one value. Such values are not
+// captured into the wildcard, as they are already known by the caller.
+func (c *cond) single() bool {
+	return c.fixed && len(c.eq) == 1 && c.match(c.eq[0])
+}
+
+// ascendLeafs calls it for every leaf of n which value matches c. Leaf with
+// Any value of the key listed in TrieConfig.AnyKeys matches c if at least one
+// value matches c.
+func ascendLeafs[T any](n *NodeOf[T], c *cond, it func(string, *LeafOf[T]) bool) bool {
+	if c.fixed && n.kinds.kind(n.key) != nil {
+		return ascendMatchLeafs(n, c, it)
+	}
+	if c.fixed {
+		var matched bool
+		for _, v := range c.eq {
+			if !c.match(v) {
+				continue
+			}
+			matched = true
+			if n.isAny(v) {
+				continue
+			}
+			if leaf := n.GetLeaf([]byte(v)); leaf != nil && !it(v, leaf) {
+				return false
+			}
+		}
+		if leaf := n.anyLeaf(n.leafs()); matched && leaf != nil {
+			return it(Any, leaf)
+		}
+		return true
+	}
+	return n.AscendLeafs(func(v string, leaf *LeafOf[T]) bool {
+		if !c.match(v) {
+			return true
+		}
+		return it(v, leaf)
+	})
+}
+
+// ascendMatchLeafs is like ascendLeafs for fixed conditions on a key having a
+// kind. Leaf matching several values of c is reported once.
+func ascendMatchLeafs[T any](n *NodeOf[T], c *cond, it func(string, *LeafOf[T]) bool) bool {
+	seen := make(map[*LeafOf[T]]bool)
+	for _, v := range c.eq {
+		if !c.match(v) {
+			continue
+		}
+		ok := n.AscendMatch([]byte(v), func(leaf *LeafOf[T]) bool {
+			if seen[leaf] {
+				return true
+			}
+			seen[leaf] = true
+			return it(leaf.Value(), leaf)
+		})
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// LookupQuery is like Lookup, but uses conditions of given query. Leafs of
+// nodes with keys having equality or set membership conditions are taken by
+// the listed values. Otherwise values of the leafs are checked one by one.
+func LookupQuery[T any](lf *LeafOf[T], query Query, s LookupStrategy, it func(*LeafOf[T]) bool) bool {
+	switch s {
+	case LookupStrategyStrict:
+		if query.Len() == 0 && !it(lf) {
+			return false
+		}
+	case LookupStrategyGreedy:
+		if query.hasKeys() && !it(lf) {
+			return false
+		}
+	}
+	if !query.follow() {
+		return true
+	}
+	handle := func(n *NodeOf[T]) bool {
+		i, ok := query.get(n.key)
+		if !ok || query.conds[i].absent {
+			return true
+		}
+		rest := query.without(i)
+		return ascendLeafs(n, &query.conds[i], func(_ string, leaf *LeafOf[T]) bool {
+			return LookupQuery(leaf, rest, s, it)
+		})
+	}
+	min, max := query.keyRange()
+	if min == max {
+		if n := lf.GetChild(min); n != nil {
+			return handle(n)
+		}
+		return true
+	}
+	return lf.AscendChildrenRange(min, max, handle)
+}
+
+// SelectQuery is like Select, but uses conditions of given query. Values of
+// nodes with keys having conditions other than equality (like NotEqual, Prefix
+// or Match) are captured into the wildcard if it has such keys.
+func SelectQuery[T any](lf *LeafOf[T], query Query, wildcard Wildcard, s LookupStrategy, it func(Wildcard, *LeafOf[T]) bool) {
+	captureQuery(lf, query, wildcard, true, s, it)
+}
+
+// LookupWildcardQuery is like LookupWildcard, but uses conditions of given
+// query. See SelectQuery for details.
+func LookupWildcardQuery[T any](lf *LeafOf[T], query Query, wildcard Wildcard, s LookupStrategy, it func(Wildcard, *LeafOf[T]) bool) {
+	captureQuery(lf, query, wildcard, false, s, it)
+}
+
+func captureQuery[T any](lf *LeafOf[T], query Query, wildcard Wildcard, greedy bool, s LookupStrategy, it func(Wildcard, *LeafOf[T]) bool) bool {
+	// stop is true if strict lookup reached the leaf where only optional keys
+	// are left. Only nodes of such keys are followed below it.
+	var stop bool
+	switch s {
+	case LookupStrategyStrict:
+		if stop = query.Len() == 0; stop {
+			if !it(wildcard, lf) {
+				return false
+			}
+			if !query.follow() {
+				return true
+			}
+		}
+	case LookupStrategyGreedy:
+		if query.hasKeys() && !it(wildcard, lf) {
+			return false
+		}
+	}
+	return lf.AscendChildren(func(n *NodeOf[T]) bool {
+		// See capture() for the reasons of wildcard reset.
+		prev, has := wildcard[n.key]
+		if i, ok := query.get(n.key); ok {
+			var (
+				c    = &query.conds[i]
+				rest = query.without(i)
+			)
+			if c.absent {
+				// Items below the node have the key.
+				return true
+			}
+			// Value of optional key is not known even if it is single,
+			// since the key could be absent.
+			has = has && (c.optional || !c.single())
+			r := ascendLeafs(n, c, func(v string, leaf *LeafOf[T]) bool {
+				if has {
+					wildcard[n.key] = v
+				}
+				return captureQuery(leaf, rest, wildcard, greedy, s, it)
+			})
+			if has {
+				wildcard[n.key] = prev
+			}
+			return r
+		}
+		if stop || !has && !greedy {
+			return true
+		}
+		r := n.AscendLeafs(func(v string, leaf *LeafOf[T]) bool {
+			if has {
+				wildcard[n.key] = v
+			}
+			return captureQuery(leaf, query, wildcard, greedy, s, it)
+		})
+		if has {
+			wildcard[n.key] = prev
+		}
+		return r
+	})
+}
+
+// LookupQuery calls LookupQuery with trie root leaf, given query and lookup
+// strategy.
+func (t *TrieOf[T]) LookupQuery(query Query, s LookupStrategy, it func(T) bool) {
+	root := t.root.Load()
+	LookupQuery(root, query, s, func(l *LeafOf[T]) bool {
+		return l.Ascend(it)
+	})
+}
+
+// SelectQuery calls SelectQuery with trie root leaf, given query, wildcard
+// and lookup strategy.
+func (t *TrieOf[T]) SelectQuery(query Query, wildcard Wildcard, s LookupStrategy, it func(Wildcard, T) bool) {
+	root := t.root.Load()
+	SelectQuery(root, query, wildcard, s, func(captured Wildcard, leaf *LeafOf[T]) bool {
+		return leaf.Ascend(func(val T) bool {
+			return it(captured, val)
+		})
+	})
+}
+
+// LookupWildcardQuery calls LookupWildcardQuery with trie root leaf, given
+// query, wildcard and lookup strategy.
+func (t *TrieOf[T]) LookupWildcardQuery(query Query, wildcard Wildcard, s LookupStrategy, it func(Wildcard, T) bool) {
+	root := t.root.Load()
+	LookupWildcardQuery(root, query, wildcard, s, func(captured Wildcard, leaf *LeafOf[T]) bool {
+		return leaf.Ascend(func(val T) bool {
+			return it(captured, val)
+		})
+	})
+}
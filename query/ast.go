@@ -0,0 +1,168 @@
+// Package query implements text query language for the radix trie.
+//
+// Query is a boolean expression of conditions on path values, e.g.:
+//
+//	1="a" AND (2 IN ("x","y") OR NOT 3="z")
+//
+// Keys are unsigned integers (decimal, or hexadecimal with 0x prefix), values
+// are double quoted Go string literals. NOT binds tighter than AND, which
+// binds tighter than OR. Keywords are case insensitive.
+//
+// Conditions on a key which is not present in the item's path are false. That
+// is, 3!="z" requires item path to have key 3, while NOT 3="z" does not.
+package query
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Expr is a node of query expression tree.
+type Expr interface {
+	// String returns canonical text representation of the expression.
+	String() string
+
+	expr()
+}
+
+// Op is an operator of the condition.
+type Op uint8
+
+const (
+	OpEqual Op = iota
+	OpNotEqual
+	OpIn
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpEqual:
+		return "="
+	case OpNotEqual:
+		return "!="
+	case OpIn:
+		return "IN"
+	default:
+		return "Op(" + strconv.Itoa(int(op)) + ")"
+	}
+}
+
+// Cond is a condition on value of the key. OpEqual and OpNotEqual conditions
+// must have exactly one value; OpIn must have at least one.
+type Cond struct {
+	Key    uint
+	Op     Op
+	Values []string
+}
+
+// Not is a negation of expression.
+type Not struct {
+	X Expr
+}
+
+// And is a conjunction of expressions.
+type And struct {
+	X []Expr
+}
+
+// Or is a disjunction of expressions.
+type Or struct {
+	X []Expr
+}
+
+func (*Cond) expr() {}
+func (*Not) expr()  {}
+func (*And) expr()  {}
+func (*Or) expr()   {}
+
+func (c *Cond) String() string { return format(c) }
+func (n *Not) String() string  { return format(n) }
+func (a *And) String() string  { return format(a) }
+func (o *Or) String() string   { return format(o) }
+
+// Operator precedence used to decide whether parentheses are needed.
+const (
+	precOr = iota
+	precAnd
+	precNot
+)
+
+func format(e Expr) string {
+	var sb strings.Builder
+	printExpr(&sb, e, precOr)
+	return sb.String()
+}
+
+func printExpr(sb *strings.Builder, e Expr, prec int) {
+	switch x := e.(type) {
+	case *Cond:
+		sb.WriteString(strconv.FormatUint(uint64(x.Key), 10))
+		if x.Op != OpIn {
+			sb.WriteString(x.Op.String())
+			if len(x.Values) > 0 {
+				sb.WriteString(strconv.Quote(x.Values[0]))
+			}
+			return
+		}
+		sb.WriteString(" IN (")
+		values := slices.Clone(x.Values)
+		slices.Sort(values)
+		for i, v := range slices.Compact(values) {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(strconv.Quote(v))
+		}
+		sb.WriteByte(')')
+
+	case *Not:
+		sb.WriteString("NOT ")
+		printExpr(sb, x.X, precNot)
+
+	case *And:
+		printList(sb, x.X, " AND ", precAnd, prec)
+
+	case *Or:
+		printList(sb, x.X, " OR ", precOr, prec)
+	}
+}
+
+// printList prints operands of n-ary operator. Nested operators of the same
+// kind are flattened.
+func printList(sb *strings.Builder, xs []Expr, sep string, own, prec int) {
+	if own < prec {
+		sb.WriteByte('(')
+		defer sb.WriteByte(')')
+	}
+	var i int
+	var walk func([]Expr)
+	walk = func(xs []Expr) {
+		for _, x := range xs {
+			if same := nested(x, own); same != nil {
+				walk(same)
+				continue
+			}
+			if i > 0 {
+				sb.WriteString(sep)
+			}
+			i++
+			printExpr(sb, x, own+1)
+		}
+	}
+	walk(xs)
+}
+
+func nested(x Expr, prec int) []Expr {
+	switch x := x.(type) {
+	case *And:
+		if prec == precAnd {
+			return x.X
+		}
+	case *Or:
+		if prec == precOr {
+			return x.X
+		}
+	}
+	return nil
+}
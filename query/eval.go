@@ -0,0 +1,296 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/gobwas/radix"
+)
+
+// ErrTooManyKeys is returned by Validate when expression has more distinct
+// keys than a path could hold.
+var ErrTooManyKeys = errors.New("query: too many keys")
+
+// ErrTooManyTerms is returned by Validate when expression has more than
+// MaxTerms conjunctions in disjunctive normal form.
+var ErrTooManyTerms = errors.New("query: too many terms")
+
+// MaxTerms is a maximum number of conjunctions an expression could be compiled
+// into. Note that their number grows exponentially with the number of ORs
+// under AND (and of ANDs under NOT).
+const MaxTerms = 1024
+
+// Validate checks that expression is well formed.
+func Validate(e Expr) error {
+	keys := make(map[uint]bool)
+	if err := validate(e, keys); err != nil {
+		return err
+	}
+	if len(keys) > radix.MaxPathSize {
+		return ErrTooManyKeys
+	}
+	if countTerms(e, false) > MaxTerms {
+		return ErrTooManyTerms
+	}
+	return nil
+}
+
+// countTerms returns number of conjunctions in disjunctive normal form of e
+// negated if neg is true, as dnf would return them. It stops counting after
+// MaxTerms.
+func countTerms(e Expr, neg bool) int {
+	switch x := e.(type) {
+	case *Cond:
+		return 1
+	case *Not:
+		return countTerms(x.X, !neg)
+	case *And:
+		if neg {
+			return countUnion(x.X, neg)
+		}
+		return countProduct(x.X, neg)
+	case *Or:
+		if neg {
+			return countProduct(x.X, neg)
+		}
+		return countUnion(x.X, neg)
+	}
+	panic("query: unexpected expression")
+}
+
+func countUnion(xs []Expr, neg bool) (n int) {
+	for _, x := range xs {
+		n = min(n+countTerms(x, neg), MaxTerms+1)
+	}
+	return n
+}
+
+func countProduct(xs []Expr, neg bool) int {
+	n := 1
+	for _, x := range xs {
+		n = min(n*countTerms(x, neg), MaxTerms+1)
+	}
+	return n
+}
+
+func validate(e Expr, keys map[uint]bool) error {
+	switch x := e.(type) {
+	case *Cond:
+		if x == nil {
+			return errors.New("query: nil condition")
+		}
+		switch x.Op {
+		case OpEqual, OpNotEqual:
+			if len(x.Values) != 1 {
+				return fmt.Errorf("query: %s condition on key %d must have one value", x.Op, x.Key)
+			}
+		case OpIn:
+			if len(x.Values) == 0 {
+				return fmt.Errorf("query: %s condition on key %d must have values", x.Op, x.Key)
+			}
+		default:
+			return fmt.Errorf("query: unknown operator %s", x.Op)
+		}
+		keys[x.Key] = true
+		return nil
+
+	case *Not:
+		if x == nil || x.X == nil {
+			return errors.New("query: empty NOT expression")
+		}
+		return validate(x.X, keys)
+
+	case *And:
+		if x == nil || len(x.X) == 0 {
+			return errors.New("query: empty AND expression")
+		}
+		return validateList(x.X, keys)
+
+	case *Or:
+		if x == nil || len(x.X) == 0 {
+			return errors.New("query: empty OR expression")
+		}
+		return validateList(x.X, keys)
+
+	default:
+		return fmt.Errorf("query: unexpected expression %T", e)
+	}
+}
+
+func validateList(xs []Expr, keys map[uint]bool) error {
+	for _, x := range xs {
+		if err := validate(x, keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Program is a compiled expression which could be evaluated against a trie.
+//
+// Expression is compiled into a disjunction of conjunctions of conditions.
+// Every conjunction is evaluated as a single trie traversal, which only visits
+// leafs with values matching the conditions. Leafs of the nodes with keys
+// having equality or IN conditions are taken by the listed values.
+type Program struct {
+	expr  Expr
+	terms []term
+}
+
+// term is a conjunction of conditions. Keys of positive conditions are
+// required by the query; conditions on other keys are satisfied if key is
+// absent.
+type term struct {
+	query radix.Query
+}
+
+// literal is a possibly negated condition.
+type literal struct {
+	cond *Cond
+	neg  bool
+}
+
+// Compile validates and compiles given expression.
+func Compile(e Expr) (*Program, error) {
+	if err := Validate(e); err != nil {
+		return nil, err
+	}
+	p := &Program{expr: e}
+	for _, lits := range dnf(e, false) {
+		p.terms = append(p.terms, compileTerm(lits))
+	}
+	return p, nil
+}
+
+// MustCompile is like Compile but panics if expression is invalid.
+func MustCompile(e Expr) *Program {
+	p, err := Compile(e)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns canonical representation of compiled expression.
+func (p *Program) String() string {
+	return p.expr.String()
+}
+
+// dnf returns disjunctive normal form of e negated if neg is true.
+func dnf(e Expr, neg bool) [][]literal {
+	switch x := e.(type) {
+	case *Cond:
+		return [][]literal{{{x, neg}}}
+	case *Not:
+		return dnf(x.X, !neg)
+	case *And:
+		if neg {
+			return union(x.X, neg)
+		}
+		return product(x.X, neg)
+	case *Or:
+		if neg {
+			return product(x.X, neg)
+		}
+		return union(x.X, neg)
+	}
+	panic("query: unexpected expression")
+}
+
+func union(xs []Expr, neg bool) (ret [][]literal) {
+	for _, x := range xs {
+		ret = append(ret, dnf(x, neg)...)
+	}
+	return ret
+}
+
+func product(xs []Expr, neg bool) [][]literal {
+	ret := [][]literal{nil}
+	for _, x := range xs {
+		var next [][]literal
+		for _, b := range dnf(x, neg) {
+			for _, a := range ret {
+				next = append(next, append(slices.Clip(a), b...))
+			}
+		}
+		ret = next
+	}
+	return ret
+}
+
+func compileTerm(lits []literal) (t term) {
+	for _, lit := range lits {
+		c := lit.cond
+		switch {
+		case !lit.neg && c.Op == OpNotEqual:
+			t.query = t.query.NotEqual(c.Key, []byte(c.Values[0]))
+		case !lit.neg:
+			t.query = t.query.In(c.Key, bytesOf(c.Values)...)
+
+		// Negated conditions are satisfied if key is absent. Otherwise
+		// value must not be equal to any of listed values.
+		case c.Op == OpNotEqual:
+			t.query = t.query.Equal(c.Key, []byte(c.Values[0]))
+		default:
+			for _, v := range c.Values {
+				t.query = t.query.NotEqual(c.Key, []byte(v))
+			}
+		}
+		if !lit.neg {
+			t.query = t.query.HasKey(c.Key)
+		}
+	}
+	return t
+}
+
+func bytesOf(ss []string) [][]byte {
+	ret := make([][]byte, len(ss))
+	for i, s := range ss {
+		ret[i] = []byte(s)
+	}
+	return ret
+}
+
+// Eval calls it for every item of the trie which path matches p. Every item
+// is reported once.
+func (p *Program) Eval(trie *radix.Trie, it func(uint) bool) {
+	EvalOf(p, trie, it)
+}
+
+// EvalOf is like Program.Eval but works with tries of any item type.
+func EvalOf[T any](p *Program, trie *radix.TrieOf[T], it func(T) bool) {
+	trie.View(func(root *radix.LeafOf[T]) {
+		MatchLeafs(p, root, func(leaf *radix.LeafOf[T]) bool {
+			return leaf.Ascend(it)
+		})
+	})
+}
+
+// MatchLeafs calls it for every leaf below root (including root itself) which
+// path relative to root matches p. Every leaf is reported once.
+func MatchLeafs[T any](p *Program, root *radix.LeafOf[T], it func(*radix.LeafOf[T]) bool) bool {
+	var seen map[*radix.LeafOf[T]]bool
+	if len(p.terms) > 1 {
+		seen = make(map[*radix.LeafOf[T]]bool)
+	}
+	for _, t := range p.terms {
+		ok := true
+		// Greedy strategy visits every leaf which path does not conflict
+		// with the query, that is, all the keys are optional.
+		radix.SelectQuery(root, t.query, nil, radix.LookupStrategyGreedy, func(_ radix.Wildcard, leaf *radix.LeafOf[T]) bool {
+			if seen[leaf] {
+				return true
+			}
+			if seen != nil {
+				seen[leaf] = true
+			}
+			ok = it(leaf)
+			return ok
+		})
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
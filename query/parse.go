@@ -0,0 +1,310 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError describes a failure to parse query text.
+type SyntaxError struct {
+	// Offset is a byte offset in the query text where error occurred.
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("query: syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// Parse parses query text into an expression tree. Returned expression is
+// validated. See package docs for the syntax.
+func Parse(s string) (Expr, error) {
+	p := parser{lexer: lexer{src: s}}
+	p.next()
+	x, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.err != nil || p.tok.kind != tokEOF {
+		return nil, p.unexpected()
+	}
+	if err := Validate(x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// MustParse is like Parse but panics if query could not be parsed.
+func MustParse(s string) Expr {
+	x, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return x
+}
+
+type parser struct {
+	lexer
+	tok token
+	err error
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex()
+}
+
+func (p *parser) keyword(kw string) bool {
+	return p.tok.kind == tokIdent && strings.EqualFold(p.tok.text, kw)
+}
+
+func (p *parser) unexpected() error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.tok.kind == tokEOF {
+		return &SyntaxError{p.tok.pos, "unexpected end of query"}
+	}
+	return &SyntaxError{p.tok.pos, fmt.Sprintf("unexpected %q", p.tok.text)}
+}
+
+func (p *parser) expect(kind tokenKind) (token, error) {
+	t := p.tok
+	if t.kind != kind || p.err != nil {
+		return t, p.unexpected()
+	}
+	p.next()
+	return t, nil
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	if !p.keyword("or") {
+		return x, nil
+	}
+	or := &Or{X: []Expr{x}}
+	for p.keyword("or") {
+		p.next()
+		if x, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		or.X = append(or.X, x)
+	}
+	return or, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.keyword("and") {
+		return x, nil
+	}
+	and := &And{X: []Expr{x}}
+	for p.keyword("and") {
+		p.next()
+		if x, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		and.X = append(and.X, x)
+	}
+	return and, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	switch {
+	case p.keyword("not"):
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{X: x}, nil
+
+	case p.tok.kind == tokLParen:
+		p.next()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen); err != nil {
+			return nil, err
+		}
+		return x, nil
+
+	default:
+		return p.parseCond()
+	}
+}
+
+// parseKey parses decimal key or hexadecimal key with 0x prefix. Decimal keys
+// must not have leading zeroes, which could be taken for octal ones.
+func parseKey(s string) (uint64, error) {
+	if len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		return strconv.ParseUint(s[2:], 16, strconv.IntSize)
+	}
+	if len(s) > 1 && s[0] == '0' {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseUint(s, 10, strconv.IntSize)
+}
+
+func (p *parser) parseCond() (Expr, error) {
+	t, err := p.expect(tokInt)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseKey(t.text)
+	if err != nil {
+		return nil, &SyntaxError{t.pos, fmt.Sprintf("invalid key %q", t.text)}
+	}
+	c := &Cond{Key: uint(key)}
+	switch {
+	case p.tok.kind == tokEqual:
+		c.Op = OpEqual
+	case p.tok.kind == tokNotEqual:
+		c.Op = OpNotEqual
+	case p.keyword("in"):
+		c.Op = OpIn
+	default:
+		return nil, p.unexpected()
+	}
+	p.next()
+	if c.Op != OpIn {
+		v, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		c.Values = []string{v}
+		return c, nil
+	}
+	if _, err := p.expect(tokLParen); err != nil {
+		return nil, err
+	}
+	for {
+		v, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		c.Values = append(c.Values, v)
+		if p.tok.kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(tokRParen); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *parser) parseString() (string, error) {
+	t, err := p.expect(tokString)
+	if err != nil {
+		return "", err
+	}
+	v, err := strconv.Unquote(t.text)
+	if err != nil {
+		return "", &SyntaxError{t.pos, fmt.Sprintf("invalid string %s", t.text)}
+	}
+	return v, nil
+}
+
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	tokInt
+	tokString
+	tokIdent
+	tokEqual
+	tokNotEqual
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) lex() (token, error) {
+	for l.pos < len(l.src) && isSpace(l.src[l.pos]) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos == len(l.src) {
+		return token{tokEOF, "", start}, nil
+	}
+	emit := func(kind tokenKind, n int) (token, error) {
+		l.pos += n
+		return token{kind, l.src[start:l.pos], start}, nil
+	}
+	switch c := l.src[l.pos]; {
+	case c == '=':
+		return emit(tokEqual, 1)
+	case c == '!' && strings.HasPrefix(l.src[l.pos:], "!="):
+		return emit(tokNotEqual, 2)
+	case c == '(':
+		return emit(tokLParen, 1)
+	case c == ')':
+		return emit(tokRParen, 1)
+	case c == ',':
+		return emit(tokComma, 1)
+	case c == '"':
+		for i := l.pos + 1; i < len(l.src); i++ {
+			switch l.src[i] {
+			case '\\':
+				i++
+			case '"':
+				return emit(tokString, i+1-l.pos)
+			}
+		}
+		return token{}, &SyntaxError{start, "unterminated string"}
+	case isDigit(c):
+		return emit(tokInt, l.span(isWord))
+	case isLetter(c):
+		return emit(tokIdent, l.span(isWord))
+	default:
+		return token{}, &SyntaxError{start, fmt.Sprintf("unexpected character %q", c)}
+	}
+}
+
+// span returns length of the longest prefix of the rest of source which
+// bytes satisfy fn.
+func (l *lexer) span(fn func(byte) bool) (n int) {
+	for l.pos+n < len(l.src) && fn(l.src[l.pos+n]) {
+		n++
+	}
+	return n
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
+
+func isWord(c byte) bool {
+	return isDigit(c) || isLetter(c)
+}
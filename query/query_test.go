@@ -0,0 +1,252 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gobwas/radix"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, test := range []struct {
+		in  string
+		exp string
+	}{
+		{`1="a"`, `1="a"`},
+		{` 1 = "a" `, `1="a"`},
+		{`0x10 != "a\tb"`, `16!="a\tb"`},
+		{`0XfF="a"`, `255="a"`},
+		{`0="a"`, `0="a"`},
+		{`2 in ("y", "x", "y")`, `2 IN ("x","y")`},
+		{
+			`1="a" AND (2 IN ("x","y") OR NOT 3="z")`,
+			`1="a" AND (2 IN ("x","y") OR NOT 3="z")`,
+		},
+		{`(1="a" and 2="b") and (3="c")`, `1="a" AND 2="b" AND 3="c"`},
+		{`1="a" or (2="b" or 3="c")`, `1="a" OR 2="b" OR 3="c"`},
+		{`1="a" OR 2="b" AND 3="c"`, `1="a" OR 2="b" AND 3="c"`},
+		{`(1="a" OR 2="b") AND 3="c"`, `(1="a" OR 2="b") AND 3="c"`},
+		{`not not (1="a" and 2="b")`, `NOT NOT (1="a" AND 2="b")`},
+		{`NOT (1="a")`, `NOT 1="a"`},
+	} {
+		t.Run(test.in, func(t *testing.T) {
+			x, err := Parse(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if act := x.String(); act != test.exp {
+				t.Errorf("String() = %s; want %s", act, test.exp)
+			}
+			y, err := Parse(x.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, b := y.String(), x.String(); a != b {
+				t.Errorf("String() of reparsed expression = %s; want %s", a, b)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, test := range []struct {
+		in     string
+		offset int
+	}{
+		{``, 0},
+		{`1`, 1},
+		{`1=`, 2},
+		{`1="a`, 2},
+		{`1=a`, 2},
+		{`x="a"`, 0},
+		{`1="a" AND`, 9},
+		{`1="a" 2="b"`, 6},
+		{`(1="a"`, 6},
+		{`1 IN ()`, 6},
+		{`1 IN ("a",)`, 10},
+		{`1="a" ? 2="b"`, 6},
+		{`99999999999999999999999="a"`, 0},
+		{`010="a"`, 0},
+		{`1_0="a"`, 0},
+		{`0b101="a"`, 0},
+		{`0o7="a"`, 0},
+		{`0x="a"`, 0},
+		{`0x1_0="a"`, 0},
+	} {
+		t.Run(test.in, func(t *testing.T) {
+			_, err := Parse(test.in)
+			var serr *SyntaxError
+			if !errors.As(err, &serr) {
+				t.Fatalf("Parse() error = %v; want syntax error", err)
+			}
+			if serr.Offset != test.offset {
+				t.Errorf("Parse() error offset = %d; want %d (%v)", serr.Offset, test.offset, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	many := &And{}
+	for i := 0; i <= radix.MaxPathSize; i++ {
+		many.X = append(many.X, &Cond{Key: uint(i), Op: OpEqual, Values: []string{"a"}})
+	}
+	// Product of 11 disjunctions of two conditions has 2^11 terms.
+	huge := &And{}
+	for i := 0; i < 11; i++ {
+		huge.X = append(huge.X, &Or{[]Expr{
+			&Cond{Key: uint(i % 2), Op: OpEqual, Values: []string{"a"}},
+			&Cond{Key: uint(i % 2), Op: OpEqual, Values: []string{"b"}},
+		}})
+	}
+	for _, test := range []struct {
+		name string
+		expr Expr
+		err  error
+	}{
+		{"valid", &Not{&Cond{1, OpIn, []string{"a", "b"}}}, nil},
+		{"no values", &Cond{1, OpIn, nil}, errAny},
+		{"many values", &Cond{1, OpEqual, []string{"a", "b"}}, errAny},
+		{"bad operator", &Cond{1, Op(42), []string{"a"}}, errAny},
+		{"empty and", &Or{[]Expr{&Cond{1, OpEqual, []string{"a"}}, &And{}}}, errAny},
+		{"empty not", &Not{}, errAny},
+		{"too many keys", many, ErrTooManyKeys},
+		{"too many terms", huge, ErrTooManyTerms},
+		{"too many negated terms", &Not{&Or{[]Expr{&Not{huge}}}}, ErrTooManyTerms},
+		{"max terms", &And{huge.X[:10]}, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.expr)
+			switch {
+			case test.err == nil && err != nil:
+				t.Errorf("Validate() error = %v; want nil", err)
+			case test.err == errAny && err == nil:
+				t.Errorf("Validate() error is nil; want error")
+			case test.err != nil && test.err != errAny && !errors.Is(err, test.err):
+				t.Errorf("Validate() error = %v; want %v", err, test.err)
+			}
+		})
+	}
+}
+
+var errAny = errors.New("any error")
+
+func TestEval(t *testing.T) {
+	trie := radix.New(&radix.TrieConfig{NodeOrder: []uint{2}})
+	for i := 0; i < 300; i++ {
+		m := map[uint]string{}
+		for j, n := 0, rand.Intn(5); j < n; j++ {
+			m[uint(rand.Intn(5))] = fmt.Sprintf("v%d", rand.Intn(3))
+		}
+		trie.Insert(radix.PathFromMapStr(m), uint(i))
+	}
+	for i := 0; i < 300; i++ {
+		x := randExpr(3)
+		if err := Validate(x); err != nil {
+			t.Fatal(err)
+		}
+		exp := map[uint]int{}
+		trie.ForEach(radix.Path{}, func(trace []radix.PairStr, v uint) bool {
+			m := map[uint]string{}
+			for _, p := range trace {
+				m[p.Key] = p.Value
+			}
+			if match(x, m) {
+				exp[v]++
+			}
+			return true
+		})
+		act := map[uint]int{}
+		MustCompile(x).Eval(trie, func(v uint) bool {
+			act[v]++
+			return true
+		})
+		if !reflect.DeepEqual(act, exp) {
+			t.Fatalf("Eval(%s) = %v; want %v", x, act, exp)
+		}
+	}
+}
+
+func TestEvalStop(t *testing.T) {
+	trie := radix.New(nil)
+	for i := uint(0); i < 10; i++ {
+		trie.Insert(radix.PathFromMapStr(map[uint]string{1: fmt.Sprint(i)}), i)
+	}
+	var n int
+	MustCompile(MustParse(`1!="3" OR 1="3"`)).Eval(trie, func(uint) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Errorf("iterator called %d times; want 3", n)
+	}
+}
+
+// match evaluates expression against path.
+func match(e Expr, path map[uint]string) bool {
+	switch x := e.(type) {
+	case *Cond:
+		v, ok := path[x.Key]
+		if !ok {
+			return false
+		}
+		if x.Op == OpNotEqual {
+			return v != x.Values[0]
+		}
+		return slices.Contains(x.Values, v)
+	case *Not:
+		return !match(x.X, path)
+	case *And:
+		for _, x := range x.X {
+			if !match(x, path) {
+				return false
+			}
+		}
+		return true
+	case *Or:
+		for _, x := range x.X {
+			if match(x, path) {
+				return true
+			}
+		}
+		return false
+	}
+	panic("unexpected expression")
+}
+
+func randExpr(depth int) Expr {
+	if depth == 0 || rand.Intn(3) == 0 {
+		c := &Cond{
+			Key: uint(rand.Intn(5)),
+			Op:  Op(rand.Intn(3)),
+		}
+		n := 1
+		if c.Op == OpIn {
+			n += rand.Intn(3)
+		}
+		for i := 0; i < n; i++ {
+			c.Values = append(c.Values, fmt.Sprintf("v%d", rand.Intn(3)))
+		}
+		return c
+	}
+	switch rand.Intn(3) {
+	case 0:
+		return &Not{randExpr(depth - 1)}
+	case 1:
+		return &And{[]Expr{randExpr(depth - 1), randExpr(depth - 1)}}
+	default:
+		return &Or{[]Expr{randExpr(depth - 1), randExpr(depth - 1)}}
+	}
+}
+
+func TestCompileString(t *testing.T) {
+	const s = `1="a" AND NOT (2="b" OR 3 IN ("c","d"))`
+	if act := MustCompile(MustParse(strings.ToLower(s))).String(); act != s {
+		t.Errorf("String() = %s; want %s", act, s)
+	}
+}
@@ -0,0 +1,460 @@
+package radix_test
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"slices"
+	"testing"
+
+	. "github.com/gobwas/radix"
+)
+
+type queryCond struct {
+	key uint
+	eq  string
+	ne  string
+	in  []string
+}
+
+func (c queryCond) match(v string) bool {
+	if c.in != nil && !slices.Contains(c.in, v) {
+		return false
+	}
+	return (c.eq == "" || v == c.eq) && v != c.ne
+}
+
+func buildQuery(conds []queryCond) Query {
+	var q Query
+	for _, c := range conds {
+		if c.eq != "" {
+			q = q.Equal(c.key, []byte(c.eq))
+		}
+		if c.ne != "" {
+			q = q.NotEqual(c.key, []byte(c.ne))
+		}
+		if c.in != nil {
+			var values [][]byte
+			for _, v := range c.in {
+				values = append(values, []byte(v))
+			}
+			q = q.In(c.key, values...)
+		}
+	}
+	return q
+}
+
+func randQueryConds() (conds []queryCond) {
+	for k, n := 0, 1+rand.Intn(3); k < 6 && len(conds) < n; k++ {
+		if rand.Intn(2) == 0 {
+			continue
+		}
+		c := queryCond{key: uint(k)}
+		switch rand.Intn(5) {
+		case 0:
+			c.eq = fmt.Sprintf("v%d", rand.Intn(3))
+		case 1:
+			c.ne = fmt.Sprintf("v%d", rand.Intn(3))
+		case 2:
+			c.eq = fmt.Sprintf("v%d", rand.Intn(3))
+			c.ne = fmt.Sprintf("v%d", rand.Intn(3))
+		case 3:
+			c.in = []string{"v0", "v2"}
+		case 4:
+			c.in = []string{"v1", "v2", "v1", "v3"}
+			c.ne = fmt.Sprintf("v%d", rand.Intn(3))
+		}
+		conds = append(conds, c)
+	}
+	return conds
+}
+
+// expectQuery returns entries of trie which paths match conds. In strict
+// mode every key of conds must be present in the path and the last node on
+// the way to the item's leaf must have one of conds keys, since strict
+// traversal stops when all conditions are satisfied.
+func expectQuery(trie *Trie, conds []queryCond, strict bool) (ret []Entry[uint]) {
+	trie.ForEach(Path{}, func(trace []PairStr, v uint) bool {
+		p := PathFromSliceStr(trace)
+		for _, c := range conds {
+			x, ok := p.Get(c.key)
+			if !ok && strict || ok && !c.match(string(x)) {
+				return true
+			}
+		}
+		if strict && len(trace) > 0 && !slices.ContainsFunc(conds, func(c queryCond) bool {
+			return c.key == trace[len(trace)-1].Key
+		}) {
+			return true
+		}
+		ret = append(ret, Entry[uint]{Path: p, Item: v})
+		return true
+	})
+	return ret
+}
+
+func TestTrieSelectQuery(t *testing.T) {
+	trie := New(&TrieConfig{NodeOrder: []uint{2}})
+	for _, e := range randEntries(300) {
+		trie.Insert(e.Path, e.Item)
+	}
+	for i := 0; i < 100; i++ {
+		conds := randQueryConds()
+		query := buildQuery(conds)
+		for _, s := range []LookupStrategy{
+			LookupStrategyStrict,
+			LookupStrategyGreedy,
+		} {
+			act := map[string]int{}
+			trie.SelectQuery(query, NewWildcard(0, 1, 2, 3, 4, 5), s, func(w Wildcard, v uint) bool {
+				m := map[uint]string{}
+				for key, value := range w {
+					if value != "" {
+						m[key] = value
+					}
+				}
+				act[fmt.Sprint(PathFromMapStr(m), v)]++
+				return true
+			})
+			exp := map[string]int{}
+			for _, e := range expectQuery(trie, conds, s == LookupStrategyStrict) {
+				// Values which are fixed by query are not captured.
+				p := e.Path
+				for _, c := range conds {
+					if c.eq != "" {
+						p = p.Without(c.key)
+					}
+				}
+				exp[fmt.Sprint(p, e.Item)]++
+			}
+			if !reflect.DeepEqual(act, exp) {
+				t.Fatalf("SelectQuery(%s, %v) = %v; want %v", query, s, act, exp)
+			}
+		}
+	}
+}
+
+func TestTrieSelectQueryPath(t *testing.T) {
+	trie := New(nil)
+	for _, e := range randEntries(300) {
+		trie.Insert(e.Path, e.Item)
+	}
+	for i := 0; i < 50; i++ {
+		m := map[uint]string{}
+		for j, n := 0, rand.Intn(3); j < n; j++ {
+			m[uint(rand.Intn(6))] = fmt.Sprintf("v%d", rand.Intn(3))
+		}
+		p := PathFromMapStr(m)
+		query := NewQuery(p)
+		for _, test := range []struct {
+			s      LookupStrategy
+			selekt func(Path, Wildcard, func(Wildcard, uint) bool)
+		}{
+			{LookupStrategyStrict, trie.SelectStrict},
+			{LookupStrategyGreedy, trie.SelectGreedy},
+		} {
+			var (
+				act = map[string]int{}
+				exp = map[string]int{}
+			)
+			trie.SelectQuery(query, NewWildcard(1), test.s, func(w Wildcard, v uint) bool {
+				act[fmt.Sprint(w, v)]++
+				return true
+			})
+			test.selekt(p, NewWildcard(1), func(w Wildcard, v uint) bool {
+				exp[fmt.Sprint(w, v)]++
+				return true
+			})
+			if !reflect.DeepEqual(act, exp) {
+				t.Fatalf("SelectQuery(%s, %v) = %v; want %v", query, test.s, act, exp)
+			}
+		}
+	}
+}
+
+func TestTrieLookupQuery(t *testing.T) {
+	trie := New(&TrieConfig{NodeOrder: []uint{3, 1}})
+	for i := uint(0); i < 100; i++ {
+		trie.Insert(PathFromMapStr(map[uint]string{
+			1: fmt.Sprintf("v%d", rand.Intn(3)),
+			2: fmt.Sprintf("v%d", rand.Intn(3)),
+			3: fmt.Sprintf("v%d", rand.Intn(3)),
+		}), i)
+	}
+	for i := 0; i < 50; i++ {
+		conds := make([]queryCond, 3)
+		for j := range conds {
+			conds[j].key = uint(j + 1)
+			if rand.Intn(2) == 0 {
+				conds[j].eq = fmt.Sprintf("v%d", rand.Intn(3))
+			} else {
+				conds[j].ne = fmt.Sprintf("v%d", rand.Intn(3))
+			}
+		}
+		query := buildQuery(conds)
+		act := map[uint]int{}
+		trie.LookupQuery(query, LookupStrategyStrict, func(v uint) bool {
+			act[v]++
+			return true
+		})
+		exp := map[uint]int{}
+		for _, e := range expectQuery(trie, conds, true) {
+			exp[e.Item]++
+		}
+		if !reflect.DeepEqual(act, exp) {
+			t.Fatalf("LookupQuery(%s) = %v; want %v", query, act, exp)
+		}
+	}
+}
+
+func TestQueryNotEqual(t *testing.T) {
+	trie := New(nil)
+	trie.Insert(PathFromMapStr(map[uint]string{1: "eu"}), 1)
+	trie.Insert(PathFromMapStr(map[uint]string{1: "us"}), 2)
+	trie.Insert(PathFromMapStr(map[uint]string{1: "asia"}), 3)
+	trie.Insert(PathFromMapStr(map[uint]string{2: "x"}), 4)
+
+	for _, test := range []struct {
+		name  string
+		query Query
+		s     LookupStrategy
+		exp   map[string]uint
+	}{
+		{
+			name:  "strict",
+			query: Query{}.NotEqual(1, []byte("eu")),
+			s:     LookupStrategyStrict,
+			exp:   map[string]uint{"us": 2, "asia": 3},
+		},
+		{
+			name:  "greedy",
+			query: Query{}.NotEqual(1, []byte("eu")),
+			s:     LookupStrategyGreedy,
+			exp:   map[string]uint{"us": 2, "asia": 3, "": 4},
+		},
+		{
+			name:  "multiple",
+			query: Query{}.NotEqual(1, []byte("eu")).NotEqual(1, []byte("us")),
+			s:     LookupStrategyStrict,
+			exp:   map[string]uint{"asia": 3},
+		},
+		{
+			name:  "excluded equal",
+			query: Query{}.Equal(1, []byte("eu")).NotEqual(1, []byte("eu")),
+			s:     LookupStrategyStrict,
+			exp:   map[string]uint{},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			act := map[string]uint{}
+			trie.SelectQuery(test.query, NewWildcard(1), test.s, func(w Wildcard, v uint) bool {
+				act[w[1]] = v
+				return true
+			})
+			if !reflect.DeepEqual(act, test.exp) {
+				t.Errorf("SelectQuery(%s) = %v; want %v", test.query, act, test.exp)
+			}
+		})
+	}
+}
+
+func TestQueryIn(t *testing.T) {
+	trie := New(&TrieConfig{NodeOrder: []uint{2, 1}})
+	for i, p := range []map[uint]string{
+		{1: "a", 2: "x"},
+		{1: "a", 2: "y"},
+		{1: "b", 2: "x"},
+		{1: "b", 2: "z"},
+		{1: "c", 2: "x"},
+		{1: "a"},
+	} {
+		trie.Insert(PathFromMapStr(p), uint(i))
+	}
+	for _, test := range []struct {
+		name  string
+		query Query
+		exp   map[uint]int
+	}{
+		{
+			name: "multiple keys",
+			query: Query{}.
+				In(1, []byte("a"), []byte("b"), []byte("a")).
+				In(2, []byte("x"), []byte("z"), []byte("w")),
+			exp: map[uint]int{0: 1, 2: 1, 3: 1},
+		},
+		{
+			name: "intersection",
+			query: Query{}.
+				In(1, []byte("a"), []byte("b")).
+				In(1, []byte("b"), []byte("c")).
+				In(2, []byte("x"), []byte("y"), []byte("z")),
+			exp: map[uint]int{2: 1, 3: 1},
+		},
+		{
+			name: "not equal",
+			query: Query{}.
+				In(1, []byte("a"), []byte("b"), []byte("c")).
+				NotEqual(1, []byte("b")).
+				Equal(2, []byte("x")),
+			exp: map[uint]int{0: 1, 4: 1},
+		},
+		{
+			name:  "empty",
+			query: Query{}.In(1).In(2, []byte("x")),
+			exp:   map[uint]int{},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			act := map[uint]int{}
+			trie.LookupQuery(test.query, LookupStrategyStrict, func(v uint) bool {
+				act[v]++
+				return true
+			})
+			if !reflect.DeepEqual(act, test.exp) {
+				t.Errorf("LookupQuery(%s) = %v; want %v", test.query, act, test.exp)
+			}
+			act = map[uint]int{}
+			trie.SelectQuery(test.query, nil, LookupStrategyStrict, func(_ Wildcard, v uint) bool {
+				act[v]++
+				return true
+			})
+			if !reflect.DeepEqual(act, test.exp) {
+				t.Errorf("SelectQuery(%s) = %v; want %v", test.query, act, test.exp)
+			}
+		})
+	}
+}
+
+func TestQueryPrefixMatch(t *testing.T) {
+	trie := New(nil)
+	trie.Insert(PathFromMapStr(map[uint]string{1: "alice"}), 1)
+	trie.Insert(PathFromMapStr(map[uint]string{1: "alina"}), 2)
+	trie.Insert(PathFromMapStr(map[uint]string{1: "bob"}), 3)
+	trie.Insert(PathFromMapStr(map[uint]string{1: "albert"}), 4)
+	trie.Insert(PathFromMapStr(map[uint]string{2: "y"}), 5)
+
+	for _, test := range []struct {
+		name   string
+		query  Query
+		greedy bool
+		exp    map[string]uint
+	}{
+		{
+			name:  "prefix",
+			query: Query{}.Prefix(1, []byte("ali")),
+			exp:   map[string]uint{"alice": 1, "alina": 2},
+		},
+		{
+			name:  "empty prefix",
+			query: Query{}.Prefix(1, nil),
+			exp:   map[string]uint{"alice": 1, "alina": 2, "bob": 3, "albert": 4},
+		},
+		{
+			name:   "select",
+			query:  Query{}.Prefix(1, []byte("ali")),
+			greedy: true,
+			exp:    map[string]uint{"alice": 1, "alina": 2, "": 5},
+		},
+		{
+			name:  "match",
+			query: Query{}.Match(1, regexp.MustCompile(`^al.*e`)),
+			exp:   map[string]uint{"alice": 1, "albert": 4},
+		},
+		{
+			name:  "prefix and match",
+			query: Query{}.Prefix(1, []byte("al")).Match(1, regexp.MustCompile(`[ae]$`)),
+			exp:   map[string]uint{"alice": 1, "alina": 2},
+		},
+		{
+			name:  "prefix and not equal",
+			query: Query{}.Prefix(1, []byte("al")).NotEqual(1, []byte("alice")),
+			exp:   map[string]uint{"alina": 2, "albert": 4},
+		},
+		{
+			name:  "prefix and in",
+			query: Query{}.Prefix(1, []byte("al")).In(1, []byte("alice"), []byte("bob")),
+			exp:   map[string]uint{"alice": 1},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			act := map[string]uint{}
+			it := func(w Wildcard, v uint) bool {
+				act[w[1]] = v
+				return true
+			}
+			if test.greedy {
+				trie.SelectQuery(test.query, NewWildcard(1), LookupStrategyGreedy, it)
+			} else {
+				trie.LookupWildcardQuery(test.query, NewWildcard(1), LookupStrategyStrict, it)
+			}
+			if !reflect.DeepEqual(act, test.exp) {
+				t.Errorf("%s = %v; want %v", test.query, act, test.exp)
+			}
+		})
+	}
+}
+
+func TestQueryKeyPresence(t *testing.T) {
+	trie := New(&TrieConfig{NodeOrder: []uint{1}})
+	trie.Insert(PathFromMapStr(map[uint]string{1: "a"}), 1)
+	trie.Insert(PathFromMapStr(map[uint]string{1: "a", 7: "x"}), 2)
+	trie.Insert(PathFromMapStr(map[uint]string{1: "b", 7: "y"}), 3)
+	trie.Insert(PathFromMapStr(map[uint]string{2: "c"}), 4)
+	trie.Insert(PathFromMapStr(map[uint]string{7: "z"}), 5)
+
+	for _, test := range []struct {
+		name  string
+		query Query
+		s     LookupStrategy
+		exp   map[uint]string
+	}{
+		{
+			name:  "has strict",
+			query: Query{}.HasKey(7),
+			s:     LookupStrategyStrict,
+			exp:   map[uint]string{2: "x", 3: "y", 5: "z"},
+		},
+		{
+			name:  "has greedy",
+			query: Query{}.HasKey(7),
+			s:     LookupStrategyGreedy,
+			exp:   map[uint]string{2: "x", 3: "y", 5: "z"},
+		},
+		{
+			name:  "has with value",
+			query: Query{}.HasKey(7).NotEqual(7, []byte("x")),
+			s:     LookupStrategyGreedy,
+			exp:   map[uint]string{3: "y", 5: "z"},
+		},
+		{
+			name:  "lacks greedy",
+			query: Query{}.LacksKey(7),
+			s:     LookupStrategyGreedy,
+			exp:   map[uint]string{1: "", 4: ""},
+		},
+		{
+			name:  "lacks strict",
+			query: Query{}.Equal(1, []byte("a")).LacksKey(7),
+			s:     LookupStrategyStrict,
+			exp:   map[uint]string{1: ""},
+		},
+		{
+			name:  "lacks overrides",
+			query: Query{}.Equal(7, []byte("z")).LacksKey(7),
+			s:     LookupStrategyGreedy,
+			exp:   map[uint]string{1: "", 4: ""},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			act := map[uint]string{}
+			trie.SelectQuery(test.query, NewWildcard(7), test.s, func(w Wildcard, v uint) bool {
+				act[v] = w[7]
+				return true
+			})
+			if !reflect.DeepEqual(act, test.exp) {
+				t.Errorf("SelectQuery(%s) = %v; want %v", test.query, act, test.exp)
+			}
+		})
+	}
+}
@@ -2,7 +2,11 @@ package radix
 
 import (
 	"bytes"
+	"cmp"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type (
@@ -17,52 +21,371 @@ type (
 
 type TrieConfig struct {
 	NodeOrder []uint
+
+	// ReverseIndex enables index of leafs where every item is stored.
+	// It makes possible to call PathsOf() and DeleteItem() methods.
+	//
+	// Note that with index enabled all trie mutations are serialized.
+	// Also, items inserted directly to leafs (not through the trie methods)
+	// are not indexed.
+	ReverseIndex bool
+
+	// BuildWorkers is a number of goroutines used by Build to construct
+	// independent subtrees. Zero or one means that trie is built
+	// sequentially. It is ignored by New.
+	BuildWorkers int
+
+	// Persistent makes trie persistent. That is, leafs and nodes of the trie
+	// are never changed once they become reachable by readers; mutations
+	// copy every leaf and node on the way from the root to the changed leaf
+	// instead. This makes Snapshot() cheap and lookups consistent with
+	// concurrent mutations.
+	//
+	// Note that mutations of persistent trie are serialized and could be
+	// made only from the root leaf.
+	Persistent bool
+
+	// Versioned makes trie keep its previous versions available for
+	// lookups. It implies Persistent option. See TrieOf.Version().
+	Versioned bool
+
+	// KeepVersions is a maximum number of versions kept by versioned trie.
+	// Zero means no limit.
+	KeepVersions int
+
+	// KeepDuration limits how long versioned trie keeps versions after they
+	// were replaced by the next ones. Zero means no limit.
+	//
+	// Note that versions are pruned only when the trie is mutated.
+	KeepDuration time.Duration
+
+	// KeyKinds maps keys to kinds describing how their stored values are
+	// matched by lookups. Values of other keys are matched by equality.
+	// See KeyKind.
+	//
+	// Note that kinds are not written by WriteFrozen; frozen trie matches
+	// all values by equality.
+	KeyKinds map[uint]KeyKind
+
+	// AnyKeys lists keys which stored Any value matches any value of the
+	// query. See Any.
+	//
+	// Unlike kinds, AnyKeys are written by WriteFrozen.
+	AnyKeys []uint
+
+	// WAL is a write-ahead log every trie mutation is appended to. It makes
+	// possible to restore the trie with Recover() after a crash. Items must
+	// be of one of the predeclared integer types.
+	//
+	// Note that with log enabled all trie mutations are serialized.
+	WAL *WAL
 }
 
-type Trie struct {
-	inserter *Inserter
-	root     *Leaf
+// Trie is a TrieOf uint items.
+type Trie = TrieOf[uint]
+
+// TrieOf is a trie of items of type T.
+type TrieOf[T any] struct {
+	// mu is held for writing by mutations which must be atomic for
+	// readers. Other mutations hold it for reading. Readers never hold it.
+	// It is not used by persistent trie.
+	mu sync.RWMutex
+
+	// wmu serializes mutations of persistent trie.
+	// cow is a private copy of the trie root being mutated exclusively.
+	wmu sync.Mutex
+	cow *cow[T]
+
+	inserter *InserterOf[T]
+	root     atomic.Pointer[LeafOf[T]]
+	index    *reverseIndex[T]
+	history  *history[T]
+	log      *walLog[T]
+	feed     feed[T]
 	//heap *Heap
+
+	persistent bool
+	readonly   bool
 }
 
+// New creates new trie of uint items.
 func New(config *TrieConfig) *Trie {
-	t := &Trie{
-		inserter: &Inserter{},
-		root:     NewLeaf(nil, ""),
+	return NewOrdered[uint](config)
+}
+
+// NewOrdered creates new trie of ordered items of type T.
+func NewOrdered[T cmp.Ordered](config *TrieConfig) *TrieOf[T] {
+	return NewOf(config, cmp.Compare[T])
+}
+
+// NewOf creates new trie of items of type T. Given compare function is used to
+// keep items ordered within the leafs. It must return negative number if a is
+// less than b, positive if a is greater than b and zero if a is equal to b.
+func NewOf[T any](config *TrieConfig, compare func(a, b T) int) *TrieOf[T] {
+	t := &TrieOf[T]{
+		inserter: &InserterOf[T]{},
 		//heap: NewHeap(2, 0),
 	}
+	root := NewLeafOf(nil, "", compare)
+	t.root.Store(root)
 
 	t.inserter.IndexNode = t.indexNode
 	if config != nil {
+		root.kinds = newKeyKinds(config)
 		t.inserter.NodeOrder = config.NodeOrder
+		t.persistent = config.Persistent || config.Versioned
+		if config.ReverseIndex {
+			t.index = newReverseIndex(compare)
+		}
+		if config.Versioned {
+			t.history = newHistory(t.root.Load(), config)
+		}
+		if config.WAL != nil {
+			t.log = newWALLog[T](config.WAL)
+		}
 	}
 
 	return t
 }
 
-func (t *Trie) Insert(p Path, v uint) bool {
-	return t.InsertTo(t.root, p, v)
+func (t *TrieOf[T]) Insert(p Path, v T) bool {
+	return t.InsertToWithPayload(nil, p, v, nil)
 }
 
-func (t *Trie) At(p Path) *Leaf {
-	return t.inserter.GetLeaf(t.root, p)
+// At returns leaf at given path. Leafs and nodes on the way are created if
+// needed.
+//
+// For persistent trie At never creates anything and returns nil if there is
+// no such leaf.
+func (t *TrieOf[T]) At(p Path) *LeafOf[T] {
+	if t.persistent {
+		_, leaf := t.inserter.route(t.root.Load(), p)
+		return leaf
+	}
+	// Leafs are created in place, like non-exclusive mutations do.
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.inserter.GetLeaf(t.root.Load(), p)
+}
+
+func (t *TrieOf[T]) InsertTo(leaf *LeafOf[T], p Path, v T) bool {
+	return t.InsertToWithPayload(leaf, p, v, nil)
+}
+
+// InsertWithPayload inserts v at given path and associates payload with it.
+// Payload is bound to the (path, v) pair; that is, the same v could have
+// different payloads under different paths. Inserting v again under the same
+// path replaces its payload.
+func (t *TrieOf[T]) InsertWithPayload(p Path, v T, payload any) bool {
+	return t.InsertToWithPayload(nil, p, v, payload)
+}
+
+// InsertToWithPayload is like InsertTo but associates payload with v.
+func (t *TrieOf[T]) InsertToWithPayload(leaf *LeafOf[T], p Path, v T, payload any) bool {
+	t.beginWrite(false)
+	defer t.endWrite(false)
+
+	return t.insertTo(leaf, p, v, payload)
 }
 
-func (t *Trie) InsertTo(leaf *Leaf, p Path, v uint) bool {
-	if p.Len() == 0 {
-		return leaf.Append(v)
+func (t *TrieOf[T]) Delete(p Path, v T) bool {
+	return t.DeleteFrom(nil, p, v)
+}
+
+func (t *TrieOf[T]) DeleteFrom(leaf *LeafOf[T], p Path, v T) (ok bool) {
+	t.beginWrite(false)
+	defer t.endWrite(false)
+
+	_, ok = t.deleteFrom(leaf, p, v)
+	return ok
+}
+
+// Move moves v stored at oldPath to newPath keeping its payload.
+// It returns false if v was not present at oldPath.
+//
+// Move is atomic for readers which use trie methods. That is, concurrent
+// lookups will find v either at oldPath or at newPath, but not in both or
+// neither of them. For non-persistent trie it is achieved by copying leafs
+// and nodes on the changed routes, thus leafs obtained before the call (e.g.
+// by At()) could no longer be the trie ones.
+func (t *TrieOf[T]) Move(oldPath, newPath Path, v T) bool {
+	t.beginWrite(true)
+	defer t.endWrite(true)
+
+	return t.move(nil, oldPath, newPath, v)
+}
+
+// Relocation describes movement of item between paths.
+type Relocation[T any] struct {
+	From Path
+	To   Path
+	Item T
+}
+
+// MoveAll is like Move but moves many items in one step. That is, readers
+// see either none or all of the relocations applied.
+// It returns number of items that were moved.
+func (t *TrieOf[T]) MoveAll(rs []Relocation[T]) (n int) {
+	t.beginWrite(true)
+	defer t.endWrite(true)
+
+	for _, r := range rs {
+		if t.move(nil, r.From, r.To, r.Item) {
+			n++
+		}
 	}
-	return t.inserter.Insert(leaf, p, v)
+	return n
 }
 
-func (t *Trie) Delete(p Path, v uint) bool {
-	return t.DeleteFrom(t.root, p, v)
+// beginWrite prepares trie for mutation. If exclusive is true, readers do not
+// see any changes made until endWrite is called. Mutations of persistent trie
+// are always exclusive.
+//
+// Exclusive mutations are made on a copy-on-write version of the trie which
+// is published by endWrite, thus readers are never blocked by writers. Other
+// mutations of non-persistent trie are made in place and only block
+// exclusive ones.
+func (t *TrieOf[T]) beginWrite(exclusive bool) {
+	if t.readonly {
+		panic("radix: trie is read-only")
+	}
+	switch {
+	case t.persistent:
+		t.wmu.Lock()
+		t.cow = newCow(t.root.Load(), t.inserter)
+	case exclusive:
+		t.mu.Lock()
+		t.cow = newCow(t.root.Load(), t.inserter)
+	default:
+		t.mu.RLock()
+	}
+	t.lockIndex()
+	if t.log != nil {
+		t.log.begin()
+	}
+	t.feed.begin()
 }
 
-func (t *Trie) DeleteFrom(leaf *Leaf, p Path, v uint) (ok bool) {
-	Lookup(leaf, p, LookupStrategyStrict, func(l *Leaf) bool {
-		if l.Remove(v) {
+// endWrite finishes mutation started by beginWrite with the same exclusive
+// argument. For persistent trie it makes the mutated copy visible to readers.
+// Changes are written to the log (if any) before that and are sent to
+// subscribers after that.
+func (t *TrieOf[T]) endWrite(exclusive bool) {
+	if t.log != nil {
+		t.log.end()
+	}
+	switch {
+	case t.persistent:
+		if root := t.cow.root; root != t.root.Load() {
+			t.root.Store(root)
+			if t.history != nil {
+				t.history.commit(root)
+			}
+		}
+		t.cow = nil
+		t.unlockIndex()
+		t.wmu.Unlock()
+	case exclusive:
+		if root := t.cow.root; root != t.root.Load() {
+			t.cow.adopt()
+			t.root.Store(root)
+		}
+		t.cow = nil
+		t.unlockIndex()
+		t.mu.Unlock()
+	default:
+		t.unlockIndex()
+		t.mu.RUnlock()
+	}
+	t.feed.end()
+}
+
+// writeRoot returns the root leaf which mutations are made on.
+// Caller must be between beginWrite and endWrite calls.
+func (t *TrieOf[T]) writeRoot() *LeafOf[T] {
+	if t.cow != nil {
+		return t.cow.root
+	}
+	return t.root.Load()
+}
+
+// insertTo inserts v with its payload and updates reverse index. Nil leaf
+// means the trie root.
+// Caller must be between beginWrite and endWrite calls.
+func (t *TrieOf[T]) insertTo(leaf *LeafOf[T], p Path, v T, payload any) (ok bool) {
+	if t.cow != nil {
+		t.cow.mustRoot(leaf)
+		ok = t.cow.insert(p, v, payload)
+	} else {
+		if leaf == nil {
+			leaf = t.root.Load()
+		}
+		var target *LeafOf[T]
+		if p.Len() == 0 {
+			target, ok = leaf, leaf.AppendWithPayload(v, payload)
+		} else {
+			target, ok = t.inserter.insert(leaf, p, v, payload, true)
+		}
+		if t.log != nil || t.feed.collecting || (ok && t.index != nil) {
+			// Leaf could be reached by different paths due to the different
+			// order of the nodes, thus we store the real one.
+			p = target.Path()
+		}
+	}
+	if ok && t.index != nil {
+		t.index.add(v, p)
+	}
+	// Payload could be replaced even if v is already present.
+	if t.feed.collecting {
+		t.feed.add(EventInsert, p, v, payload, false)
+	}
+	if t.log != nil {
+		t.log.insert(p, v, payload)
+	}
+	return ok
+}
+
+// deleteFrom removes v and updates reverse index. It returns payload of
+// removed v. Nil leaf means the trie root.
+// Caller must be between beginWrite and endWrite calls.
+func (t *TrieOf[T]) deleteFrom(leaf *LeafOf[T], p Path, v T) (payload any, ok bool) {
+	return t.remove(leaf, p, v, false)
+}
+
+// remove is like deleteFrom, but if exact is true it removes v only from the
+// leaf with exactly path p.
+func (t *TrieOf[T]) remove(leaf *LeafOf[T], p Path, v T, exact bool) (payload any, ok bool) {
+	removed := func(path Path, l *LeafOf[T]) {
+		if t.index != nil {
+			t.index.remove(v, path)
+		}
+		if t.log != nil {
+			t.log.delete(path, v)
+		}
+		if t.feed.collecting {
+			t.feed.add(EventDelete, path, v, nil, l.ItemCount() == 0)
+		}
+	}
+	if t.cow != nil {
+		t.cow.mustRoot(leaf)
+		return t.cow.delete(p, v, exact, removed)
+	}
+	if leaf == nil {
+		leaf = t.root.Load()
+	}
+	lookup(leaf, p, LookupStrategyStrict, true, func(l *LeafOf[T]) bool {
+		var path Path
+		if exact || t.index != nil || t.log != nil || t.feed.collecting {
+			path = l.Path()
+		}
+		if exact && path.Len() != p.Len() {
+			return true
+		}
+		x, has := l.Payload(v)
+		if has && l.Remove(v) {
 			ok = true
+			payload = x
+			removed(path, l)
 			cleanupBottomTop(l)
 		}
 		return true
@@ -70,11 +393,73 @@ func (t *Trie) DeleteFrom(leaf *Leaf, p Path, v uint) (ok bool) {
 	return
 }
 
+// insertExact inserts v with its payload to the leaf with exactly path p
+// and removes v from other such leafs, if any. It is used to apply recorded
+// changes on top of the trie which could have a different shape than the one
+// the changes were recorded from. That is, leaf with the same path could be
+// reached by different routes in these tries.
+// Caller must be between exclusive beginWrite and endWrite calls.
+func (t *TrieOf[T]) insertExact(p Path, v T, payload any) {
+	t.remove(nil, p, v, true)
+	t.insertTo(nil, p, v, payload)
+}
+
+// move moves v from oldPath to newPath. Nil leaf means the trie root.
+// Caller must be between exclusive beginWrite and endWrite calls.
+func (t *TrieOf[T]) move(leaf *LeafOf[T], oldPath, newPath Path, v T) bool {
+	payload, ok := t.deleteFrom(leaf, oldPath, v)
+	if ok {
+		t.insertTo(leaf, newPath, v, payload)
+	}
+	return ok
+}
+
+// newRoot returns empty root leaf with the same settings as the trie root.
+func (t *TrieOf[T]) newRoot() *LeafOf[T] {
+	root := t.writeRoot()
+	l := NewLeafOf(nil, "", root.cmp)
+	l.kinds = root.kinds
+	return l
+}
+
+// replaceRoot replaces all trie contents with the tree starting at root.
+// Caller must be between exclusive beginWrite and endWrite calls.
+func (t *TrieOf[T]) replaceRoot(root *LeafOf[T]) {
+	if t.feed.collecting {
+		t.feed.replace(t.writeRoot(), root)
+	}
+	if t.cow != nil {
+		t.cow.root = root
+	} else {
+		t.root.Store(root)
+	}
+	if t.index != nil {
+		t.index.items.Clear(false)
+		t.index.addTree(root)
+	}
+	if t.log != nil {
+		t.log.reset(root)
+	}
+}
+
+func (t *TrieOf[T]) lockIndex() {
+	if t.index != nil {
+		t.index.mu.Lock()
+	}
+}
+
+func (t *TrieOf[T]) unlockIndex() {
+	if t.index != nil {
+		t.index.mu.Unlock()
+	}
+}
+
 // LookupStrict calls Lookup with trie root leaf, given query and strict lookup
 // strategy.
 // If query does not contains all trie keys, use Select.
-func (t *Trie) LookupStrict(query Path, it Iterator) {
-	Lookup(t.root, query, LookupStrategyStrict, func(l *Leaf) bool {
+func (t *TrieOf[T]) LookupStrict(query Path, it func(T) bool) {
+	root := t.root.Load()
+	Lookup(root, query, LookupStrategyStrict, func(l *LeafOf[T]) bool {
 		return l.Ascend(it)
 	})
 }
@@ -82,108 +467,206 @@ func (t *Trie) LookupStrict(query Path, it Iterator) {
 // LookupGreedy calls Lookup with trie root leaf, given query and greedy lookup
 // strategy.
 // If query does not contains all trie keys, use Select.
-func (t *Trie) LookupGreedy(query Path, it Iterator) {
-	Lookup(t.root, query, LookupStrategyGreedy, func(l *Leaf) bool {
+func (t *TrieOf[T]) LookupGreedy(query Path, it func(T) bool) {
+	root := t.root.Load()
+	Lookup(root, query, LookupStrategyGreedy, func(l *LeafOf[T]) bool {
 		return l.Ascend(it)
 	})
 }
 
+// LookupStrictWithPayload is like LookupStrict but also passes payload
+// associated with every item to the iterator.
+func (t *TrieOf[T]) LookupStrictWithPayload(query Path, it func(T, any) bool) {
+	root := t.root.Load()
+	Lookup(root, query, LookupStrategyStrict, func(l *LeafOf[T]) bool {
+		return l.AscendWithPayload(it)
+	})
+}
+
+// LookupGreedyWithPayload is like LookupGreedy but also passes payload
+// associated with every item to the iterator.
+func (t *TrieOf[T]) LookupGreedyWithPayload(query Path, it func(T, any) bool) {
+	root := t.root.Load()
+	Lookup(root, query, LookupStrategyGreedy, func(l *LeafOf[T]) bool {
+		return l.AscendWithPayload(it)
+	})
+}
+
 // LookupWildcardStrict calls LookupWildcard with trie root leaf, given
 // query, wildcard and strict lookup strategy.
-func (t *Trie) LookupWildcardStrict(query Path, wildcard Wildcard, it PathIterator) {
-	LookupWildcard(t.root, query, wildcard, LookupStrategyStrict, func(captured Wildcard, leaf *Leaf) bool {
-		return leaf.Ascend(func(val uint) bool {
+func (t *TrieOf[T]) LookupWildcardStrict(query Path, wildcard Wildcard, it func(Wildcard, T) bool) {
+	root := t.root.Load()
+	LookupWildcard(root, query, wildcard, LookupStrategyStrict, func(captured Wildcard, leaf *LeafOf[T]) bool {
+		return leaf.Ascend(func(val T) bool {
 			return it(captured, val)
 		})
 	})
 }
 
+// LookupWildcardStrictWithPayload is like LookupWildcardStrict but also passes
+// payload associated with every item to the iterator.
+func (t *TrieOf[T]) LookupWildcardStrictWithPayload(query Path, wildcard Wildcard, it func(Wildcard, T, any) bool) {
+	root := t.root.Load()
+	LookupWildcard(root, query, wildcard, LookupStrategyStrict, func(captured Wildcard, leaf *LeafOf[T]) bool {
+		return leaf.AscendWithPayload(func(val T, payload any) bool {
+			return it(captured, val, payload)
+		})
+	})
+}
+
 // LookupWildcardGreedy calls LookupWildcard with trie root leaf, given
 // query, wildcard and greedy lookup strategy.
-func (t *Trie) LookupWildcardGreedy(query Path, wildcard Wildcard, it PathIterator) {
-	LookupWildcard(t.root, query, wildcard, LookupStrategyGreedy, func(captured Wildcard, leaf *Leaf) bool {
-		return leaf.Ascend(func(val uint) bool {
+func (t *TrieOf[T]) LookupWildcardGreedy(query Path, wildcard Wildcard, it func(Wildcard, T) bool) {
+	root := t.root.Load()
+	LookupWildcard(root, query, wildcard, LookupStrategyGreedy, func(captured Wildcard, leaf *LeafOf[T]) bool {
+		return leaf.Ascend(func(val T) bool {
 			return it(captured, val)
 		})
 	})
 }
 
+// LookupWildcardGreedyWithPayload is like LookupWildcardGreedy but also passes
+// payload associated with every item to the iterator.
+func (t *TrieOf[T]) LookupWildcardGreedyWithPayload(query Path, wildcard Wildcard, it func(Wildcard, T, any) bool) {
+	root := t.root.Load()
+	LookupWildcard(root, query, wildcard, LookupStrategyGreedy, func(captured Wildcard, leaf *LeafOf[T]) bool {
+		return leaf.AscendWithPayload(func(val T, payload any) bool {
+			return it(captured, val, payload)
+		})
+	})
+}
+
 // SelectGreedy calls Select with trie root leaf and given query and wildcard.
-func (t *Trie) SelectGreedy(query Path, wildcard Wildcard, it PathIterator) {
-	Select(t.root, query, wildcard, LookupStrategyGreedy, func(captured Wildcard, leaf *Leaf) bool {
-		return leaf.Ascend(func(val uint) bool {
+func (t *TrieOf[T]) SelectGreedy(query Path, wildcard Wildcard, it func(Wildcard, T) bool) {
+	root := t.root.Load()
+	Select(root, query, wildcard, LookupStrategyGreedy, func(captured Wildcard, leaf *LeafOf[T]) bool {
+		return leaf.Ascend(func(val T) bool {
 			return it(captured, val)
 		})
 	})
 }
 
+// SelectGreedyWithPayload is like SelectGreedy but also passes payload associated
+// with every item to the iterator.
+func (t *TrieOf[T]) SelectGreedyWithPayload(query Path, wildcard Wildcard, it func(Wildcard, T, any) bool) {
+	root := t.root.Load()
+	Select(root, query, wildcard, LookupStrategyGreedy, func(captured Wildcard, leaf *LeafOf[T]) bool {
+		return leaf.AscendWithPayload(func(val T, payload any) bool {
+			return it(captured, val, payload)
+		})
+	})
+}
+
 // SelectStrict calls Select with trie root leaf and given query and wildcard.
-func (t *Trie) SelectStrict(query Path, wildcard Wildcard, it PathIterator) {
-	Select(t.root, query, wildcard, LookupStrategyStrict, func(captured Wildcard, leaf *Leaf) bool {
-		return leaf.Ascend(func(val uint) bool {
+func (t *TrieOf[T]) SelectStrict(query Path, wildcard Wildcard, it func(Wildcard, T) bool) {
+	root := t.root.Load()
+	Select(root, query, wildcard, LookupStrategyStrict, func(captured Wildcard, leaf *LeafOf[T]) bool {
+		return leaf.Ascend(func(val T) bool {
 			return it(captured, val)
 		})
 	})
 }
 
-func (t *Trie) Root() *Leaf {
-	return t.root
+// SelectStrictWithPayload is like SelectStrict but also passes payload associated
+// with every item to the iterator.
+func (t *TrieOf[T]) SelectStrictWithPayload(query Path, wildcard Wildcard, it func(Wildcard, T, any) bool) {
+	root := t.root.Load()
+	Select(root, query, wildcard, LookupStrategyStrict, func(captured Wildcard, leaf *LeafOf[T]) bool {
+		return leaf.AscendWithPayload(func(val T, payload any) bool {
+			return it(captured, val, payload)
+		})
+	})
+}
+
+func (t *TrieOf[T]) Root() *LeafOf[T] {
+	return t.root.Load()
+}
+
+// View calls fn with the trie root leaf. Trie mutations are not visible to fn
+// until it returns, thus fn could safely traverse the trie using package
+// functions like Lookup or Select.
+func (t *TrieOf[T]) View(fn func(root *LeafOf[T])) {
+	root := t.root.Load()
+	fn(root)
 }
 
 // ForEach searches all leafs by given query from root and then dig down
 // calling it on every leaf. Note that trace argument of iterator call is valid
 // only for a lifetime of call of iterator.
-func (t *Trie) ForEach(query Path, it TraceIterator) {
-	ForEach(t.root, query, it)
+func (t *TrieOf[T]) ForEach(query Path, it func([]PairStr, T) bool) {
+	root := t.root.Load()
+	ForEach(root, query, it)
+}
+
+// ForEachWithPayload is like ForEach but also passes payload associated with
+// every item to the iterator.
+func (t *TrieOf[T]) ForEachWithPayload(query Path, it func([]PairStr, T, any) bool) {
+	root := t.root.Load()
+	ForEachWithPayload(root, query, it)
 }
 
 // Walk searches all leafs by given query from root and then dig down
 // calling visitor methods on every leaf and node.
-func (t *Trie) Walk(query Path, v Visitor) {
-	Walk(t.root, query, v)
+func (t *TrieOf[T]) Walk(query Path, v VisitorOf[T]) {
+	root := t.root.Load()
+	Walk(root, query, v)
 }
 
 // ItemCount returns number of items on every Leaf which is reachable from
 // found Leaf by a query.
-func (t *Trie) ItemCount(query Path) int {
-	v := ItemCountVisitor{}
-	Walk(t.root, query, &v)
+func (t *TrieOf[T]) ItemCount(query Path) int {
+	root := t.root.Load()
+	v := ItemCountVisitorOf[T]{}
+	Walk(root, query, &v)
 	return v.Count()
 }
 
 // SizeOf counts number of leafs and nodes of every leafs that matches query.
-func (t *Trie) SizeOf(query Path) (leafs, nodes int) {
-	return SizeOf(t.root, query)
+func (t *TrieOf[T]) SizeOf(query Path) (leafs, nodes int) {
+	root := t.root.Load()
+	return SizeOf(root, query)
 }
 
-func SizeOf(leaf *Leaf, query Path) (leafs, nodes int) {
-	v := &InspectorVisitor{}
-	Lookup(leaf, query, LookupStrategyStrict, func(l *Leaf) bool {
+func SizeOf[T any](leaf *LeafOf[T], query Path) (leafs, nodes int) {
+	v := &InspectorVisitorOf[T]{}
+	lookup(leaf, query, LookupStrategyStrict, true, func(l *LeafOf[T]) bool {
 		Dig(leaf, v)
 		return true
 	})
 	return v.Leafs(), v.Nodes()
 }
 
-func ForEach(leaf *Leaf, query Path, it TraceIterator) {
-	Lookup(leaf, query, LookupStrategyStrict, func(l *Leaf) bool {
-		return Dig(l, leafVisitor(func(trace []PairStr, lf *Leaf) bool {
-			return lf.Ascend(func(v uint) bool {
+func ForEach[T any](leaf *LeafOf[T], query Path, it func([]PairStr, T) bool) {
+	lookup(leaf, query, LookupStrategyStrict, true, func(l *LeafOf[T]) bool {
+		return Dig(l, leafVisitor[T](func(trace []PairStr, lf *LeafOf[T]) bool {
+			return lf.Ascend(func(v T) bool {
 				return it(trace, v)
 			})
 		}))
 	})
 }
 
-func Walk(leaf *Leaf, query Path, v Visitor) {
-	Lookup(leaf, query, LookupStrategyStrict, func(l *Leaf) bool {
+// ForEachWithPayload is like ForEach but also passes payload associated with
+// every item to the iterator.
+func ForEachWithPayload[T any](leaf *LeafOf[T], query Path, it func([]PairStr, T, any) bool) {
+	lookup(leaf, query, LookupStrategyStrict, true, func(l *LeafOf[T]) bool {
+		return Dig(l, leafVisitor[T](func(trace []PairStr, lf *LeafOf[T]) bool {
+			return lf.AscendWithPayload(func(v T, payload any) bool {
+				return it(trace, v, payload)
+			})
+		}))
+	})
+}
+
+func Walk[T any](leaf *LeafOf[T], query Path, v VisitorOf[T]) {
+	lookup(leaf, query, LookupStrategyStrict, true, func(l *LeafOf[T]) bool {
 		return Dig(l, v)
 	})
 }
 
-func cleanupBottomTop(leaf *Leaf) {
+func cleanupBottomTop[T any](leaf *LeafOf[T]) {
 	var (
-		n  *Node
+		n  *NodeOf[T]
 		ok bool
 	)
 	for leaf.Empty() {
@@ -268,7 +751,7 @@ func (c Wildcard) String() string {
 //
 // If you have query with all keys of trie, you could use Lookup,
 // that is more efficient.
-func Select(lf *Leaf, query Path, wildcard Wildcard, s LookupStrategy, it PathLeafIterator) {
+func Select[T any](lf *LeafOf[T], query Path, wildcard Wildcard, s LookupStrategy, it func(Wildcard, *LeafOf[T]) bool) {
 	capture(lf, query, wildcard, true, s, it)
 }
 
@@ -285,11 +768,11 @@ func Select(lf *Leaf, query Path, wildcard Wildcard, s LookupStrategy, it PathLe
 //
 // If you have query with all keys of trie, you could use Lookup,
 // that is more efficient.
-func LookupWildcard(lf *Leaf, query Path, wildcard Wildcard, s LookupStrategy, it PathLeafIterator) {
+func LookupWildcard[T any](lf *LeafOf[T], query Path, wildcard Wildcard, s LookupStrategy, it func(Wildcard, *LeafOf[T]) bool) {
 	capture(lf, query, wildcard, false, s, it)
 }
 
-func capture(lf *Leaf, query Path, wildcard Wildcard, greedy bool, s LookupStrategy, it PathLeafIterator) bool {
+func capture[T any](lf *LeafOf[T], query Path, wildcard Wildcard, greedy bool, s LookupStrategy, it func(Wildcard, *LeafOf[T]) bool) bool {
 	switch s {
 	case LookupStrategyStrict:
 		if query.Len() == 0 {
@@ -300,17 +783,16 @@ func capture(lf *Leaf, query Path, wildcard Wildcard, greedy bool, s LookupStrat
 			return false
 		}
 	}
-	return lf.AscendChildren(func(n *Node) bool {
+	return lf.AscendChildren(func(n *NodeOf[T]) bool {
 		// If query has filter for this node.
 		if v, ok := query.Get(n.key); ok {
-			if leaf := n.GetLeaf(v); leaf != nil {
-				// We do not make wildcard.With(n.key, v) because it is already
-				// exists in query. That is we fill wildcard only with keys and
-				// values that are not exists in query.
+			// We do not make wildcard.With(n.key, v) because it is already
+			// exists in query. That is we fill wildcard only with keys and
+			// values that are not exists in query. Other leafs are filtered
+			// cause they do not fit query.
+			return n.AscendMatch(v, func(leaf *LeafOf[T]) bool {
 				return capture(leaf, query.Without(n.key), wildcard, greedy, s, it)
-			}
-			// Filter this leaf cause it does not fit query.
-			return true
+			})
 		}
 
 		// Must reset wildcard with previous value after scanning current node.
@@ -333,7 +815,7 @@ func capture(lf *Leaf, query Path, wildcard Wildcard, greedy bool, s LookupStrat
 			// If capture() called in non-greedy mode, skip this node.
 			return true
 		}
-		r := n.AscendLeafs(func(v string, leaf *Leaf) bool {
+		r := n.AscendLeafs(func(v string, leaf *LeafOf[T]) bool {
 			if has {
 				wildcard[n.key] = v
 			}
@@ -354,8 +836,18 @@ func capture(lf *Leaf, query Path, wildcard Wildcard, greedy bool, s LookupStrat
 // trie, it is possible to loose some values if query will not contain all
 // keys.
 //
+// Leafs with Any value of keys listed in TrieConfig.AnyKeys match any value
+// of the query.
+//
 // To search by a non-complete query, call Select, that is less efficient.
-func Lookup(lf *Leaf, query Path, s LookupStrategy, it LeafIterator) bool {
+func Lookup[T any](lf *LeafOf[T], query Path, s LookupStrategy, it func(*LeafOf[T]) bool) bool {
+	return lookup(lf, query, s, false, it)
+}
+
+// lookup is like Lookup, but if exact is true it follows only leafs with
+// values equal to query values. That is, it finds leafs the way they are
+// stored, not matched.
+func lookup[T any](lf *LeafOf[T], query Path, s LookupStrategy, exact bool, it func(*LeafOf[T]) bool) bool {
 	switch s {
 	case LookupStrategyStrict:
 		if query.Len() == 0 {
@@ -367,14 +859,20 @@ func Lookup(lf *Leaf, query Path, s LookupStrategy, it LeafIterator) bool {
 		}
 	}
 
-	handle := func(n *Node) bool {
-		if v, ok := query.Get(n.key); ok {
-			leaf := n.GetLeaf(v)
-			if leaf != nil {
-				return Lookup(n.GetsertLeaf(v), query.Without(n.key), s, it)
+	handle := func(n *NodeOf[T]) bool {
+		v, ok := query.Get(n.key)
+		if !ok {
+			return true
+		}
+		if exact {
+			if leaf := n.GetLeaf(v); leaf != nil {
+				return lookup(leaf, query.Without(n.key), s, exact, it)
 			}
+			return true
 		}
-		return true
+		return n.AscendMatch(v, func(leaf *LeafOf[T]) bool {
+			return lookup(leaf, query.Without(n.key), s, exact, it)
+		})
 	}
 
 	switch query.Len() {
@@ -392,108 +890,117 @@ func Lookup(lf *Leaf, query Path, s LookupStrategy, it LeafIterator) bool {
 	return lf.AscendChildrenRange(min, max, handle)
 }
 
-type Visitor interface {
-	OnLeaf([]PairStr, *Leaf) bool
-	OnNode([]PairStr, *Node) bool
+// Visitor is a VisitorOf uint items.
+type Visitor = VisitorOf[uint]
+
+type VisitorOf[T any] interface {
+	OnLeaf([]PairStr, *LeafOf[T]) bool
+	OnNode([]PairStr, *NodeOf[T]) bool
 }
 
-type ItemCountVisitor struct {
+// ItemCountVisitor is an ItemCountVisitorOf uint items.
+type ItemCountVisitor = ItemCountVisitorOf[uint]
+
+type ItemCountVisitorOf[T any] struct {
 	n int
 }
 
-func (v *ItemCountVisitor) Count() int {
+func (v *ItemCountVisitorOf[T]) Count() int {
 	return v.n
 }
 
-func (v *ItemCountVisitor) OnLeaf(_ []PairStr, leaf *Leaf) bool {
+func (v *ItemCountVisitorOf[T]) OnLeaf(_ []PairStr, leaf *LeafOf[T]) bool {
 	v.n += leaf.ItemCount()
 	return true
 }
 
-func (v *ItemCountVisitor) OnNode(_ []PairStr, _ *Node) bool {
+func (v *ItemCountVisitorOf[T]) OnNode(_ []PairStr, _ *NodeOf[T]) bool {
 	return true
 }
 
-type InspectorVisitor struct {
+// InspectorVisitor is an InspectorVisitorOf uint items.
+type InspectorVisitor = InspectorVisitorOf[uint]
+
+type InspectorVisitorOf[T any] struct {
 	// WithRoot is an option to include in leafs count rooted Leaf.
 	WithRoot bool
 
 	leafs, nodes int
 }
 
-func (v *InspectorVisitor) OnLeaf(path []PairStr, _ *Leaf) bool {
+func (v *InspectorVisitorOf[T]) OnLeaf(path []PairStr, _ *LeafOf[T]) bool {
 	if len(path) != 0 || v.WithRoot {
 		v.leafs++
 	}
 	return true
 }
 
-func (v *InspectorVisitor) OnNode(_ []PairStr, _ *Node) bool {
+func (v *InspectorVisitorOf[T]) OnNode(_ []PairStr, _ *NodeOf[T]) bool {
 	v.nodes++
 	return true
 }
 
-func (v *InspectorVisitor) Leafs() int { return v.leafs }
-func (v *InspectorVisitor) Nodes() int { return v.nodes }
+func (v *InspectorVisitorOf[T]) Leafs() int { return v.leafs }
+func (v *InspectorVisitorOf[T]) Nodes() int { return v.nodes }
 
-func Dig(leaf *Leaf, visitor Visitor) bool {
+func Dig[T any](leaf *LeafOf[T], visitor VisitorOf[T]) bool {
 	return dig(leaf, nil, visitor)
 }
 
-func dig(leaf *Leaf, trace []PairStr, v Visitor) bool {
+func dig[T any](leaf *LeafOf[T], trace []PairStr, v VisitorOf[T]) bool {
 	if !v.OnLeaf(trace, leaf) {
 		return false
 	}
-	return leaf.AscendChildren(func(n *Node) bool {
+	return leaf.AscendChildren(func(n *NodeOf[T]) bool {
 		if !v.OnNode(trace, n) {
 			return false
 		}
-		return n.AscendLeafs(func(val string, chLeaf *Leaf) bool {
+		return n.AscendLeafs(func(val string, chLeaf *LeafOf[T]) bool {
 			return dig(chLeaf, append(trace, PairStr{n.key, val}), v)
 		})
 	})
 }
 
-type fnVisitor struct {
-	onLeaf func([]PairStr, *Leaf) bool
-	onNode func([]PairStr, *Node) bool
+type fnVisitor[T any] struct {
+	onLeaf func([]PairStr, *LeafOf[T]) bool
+	onNode func([]PairStr, *NodeOf[T]) bool
 }
 
-func (f fnVisitor) OnLeaf(p []PairStr, l *Leaf) bool {
+func (f fnVisitor[T]) OnLeaf(p []PairStr, l *LeafOf[T]) bool {
 	if f.onLeaf != nil {
 		return f.onLeaf(p, l)
 	}
 	return true
 }
-func (f fnVisitor) OnNode(p []PairStr, n *Node) bool {
+func (f fnVisitor[T]) OnNode(p []PairStr, n *NodeOf[T]) bool {
 	if f.onNode != nil {
 		return f.onNode(p, n)
 	}
 	return true
 }
 
-func VisitorFunc(onLeaf func([]PairStr, *Leaf) bool, onNode func([]PairStr, *Node) bool) fnVisitor {
-	return fnVisitor{onLeaf, onNode}
+func VisitorFunc[T any](onLeaf func([]PairStr, *LeafOf[T]) bool, onNode func([]PairStr, *NodeOf[T]) bool) fnVisitor[T] {
+	return fnVisitor[T]{onLeaf, onNode}
 }
 
-type nodeVisitor func([]PairStr, *Node) bool
+type nodeVisitor[T any] func([]PairStr, *NodeOf[T]) bool
 
-func (self nodeVisitor) OnNode(p []PairStr, n *Node) bool {
+func (self nodeVisitor[T]) OnNode(p []PairStr, n *NodeOf[T]) bool {
 	return self(p, n)
 }
-func (nodeVisitor) OnLeaf(_ []PairStr, _ *Leaf) bool { return true }
+func (nodeVisitor[T]) OnLeaf(_ []PairStr, _ *LeafOf[T]) bool { return true }
 
-type leafVisitor func([]PairStr, *Leaf) bool
+type leafVisitor[T any] func([]PairStr, *LeafOf[T]) bool
 
-func (self leafVisitor) OnLeaf(p []PairStr, l *Leaf) bool {
+func (self leafVisitor[T]) OnLeaf(p []PairStr, l *LeafOf[T]) bool {
 	return self(p, l)
 }
 
-func (leafVisitor) OnNode(_ []PairStr, _ *Node) bool { return true }
+func (leafVisitor[T]) OnNode(_ []PairStr, _ *NodeOf[T]) bool { return true }
 
-func search(lf *Leaf, path Path) (ret []*Node) {
+func search[T any](lf *LeafOf[T], path Path) (ret []*NodeOf[T]) {
 	min, max := path.KeyRange()
-	lf.AscendChildrenRange(min, max, func(n *Node) bool {
+	lf.AscendChildrenRange(min, max, func(n *NodeOf[T]) bool {
 		if v, ok := path.Get(n.key); ok {
 			if path.Len() == 1 {
 				ret = append(ret, n)
@@ -507,28 +1014,28 @@ func search(lf *Leaf, path Path) (ret []*Node) {
 	return
 }
 
-func SearchNode(t *Trie, path Path) *Node {
-	if n := search(t.root, path); len(n) > 0 {
+func SearchNode[T any](t *TrieOf[T], path Path) *NodeOf[T] {
+	if n := search(t.Root(), path); len(n) > 0 {
 		return n[0]
 	}
 	return nil
 }
 
-func (t *Trie) indexNode(n *Node) {
+func (t *TrieOf[T]) indexNode(n *NodeOf[T]) {
 	//TODO(s.kamardin): use heap from ppgo here and sift up less hit nodes up
 	//t.heap.Insert(n)
 }
 
-type nodeIndexer func(n *Node)
+type nodeIndexer[T any] func(n *NodeOf[T])
 
 // major searches for highest majority element in node values.
 // It applies boyer-moore voting algorithm.
-func major(n *Node) (*Node, int, int) {
+func major[T any](n *NodeOf[T]) (*NodeOf[T], int, int) {
 	var total int
 	var counter int
-	var candidate *Node
-	for _, l := range n.values {
-		l.AscendChildren(func(child *Node) bool {
+	var candidate *NodeOf[T]
+	n.AscendLeafs(func(_ string, l *LeafOf[T]) bool {
+		return l.AscendChildren(func(child *NodeOf[T]) bool {
 			total++
 			switch {
 			case counter == 0:
@@ -543,26 +1050,26 @@ func major(n *Node) (*Node, int, int) {
 			}
 			return true
 		})
-	}
+	})
 	if candidate == nil {
 		return nil, -1, total
 	}
 	counter = 0
-	for _, l := range n.values {
-		l.AscendChildren(func(child *Node) bool {
+	n.AscendLeafs(func(_ string, l *LeafOf[T]) bool {
+		return l.AscendChildren(func(child *NodeOf[T]) bool {
 			//if child.key == candidate.key && child.HasLeaf(candidate.val) {
 			if child.key == candidate.key {
 				counter++
 			}
 			return true
 		})
-	}
+	})
 	return candidate, counter, total
 }
 
 // SiftUp pulls up given node in the tree.
 // Its like rotate left in the tree when the node is on the right side. =)
-func SiftUp(n *Node) *Node {
+func SiftUp[T any](n *NodeOf[T]) *NodeOf[T] {
 	pLeaf := n.parent     // parent leaf
 	pNode := pLeaf.parent // parent node
 	if pNode == nil {
@@ -573,12 +1080,14 @@ func SiftUp(n *Node) *Node {
 		return n
 	}
 	// twin clone of n
-	nn := &Node{
+	nn := &NodeOf[T]{
 		key:    n.key,
+		cmp:    n.cmp,
+		kinds:  n.kinds,
 		parent: root,
 	}
-	for val, l := range pNode.values {
-		l.AscendChildren(func(child *Node) bool {
+	pNode.AscendLeafs(func(val string, l *LeafOf[T]) bool {
+		return l.AscendChildren(func(child *NodeOf[T]) bool {
 			switch {
 			//	case child.key != n.key:
 			//		lf := nn.leaf(any)
@@ -595,30 +1104,31 @@ func SiftUp(n *Node) *Node {
 						root.RemoveEmptyChild(pNode.key)
 					}
 				}
-				for v, lf := range child.values {
+				child.AscendLeafs(func(v string, lf *LeafOf[T]) bool {
 					nlf := nn.GetsertLeafStr(v)
 					chn, _ := nlf.GetsertChild(pNode.key)
 					chlf := chn.GetsertLeafStr(val)
 					chlf.btree = lf.btree
-					chlf.children = lf.children
-					chlf.AscendChildren(func(c *Node) bool {
+					chlf.children.Store(lf.children.Load())
+					chlf.AscendChildren(func(c *NodeOf[T]) bool {
 						c.parent = chlf
 						return true
 					})
 					// cleanup
 					lf.btree = nil
-					lf.children = nil
+					lf.children.Store(nil)
 					lf.parent = nil
-				}
+					return true
+				})
 			}
 			return true
 		})
-	}
+	})
 	root.AddChild(nn)
 	return nn
 }
 
-func compress(n *Node) {
+func compress[T any](n *NodeOf[T]) {
 	m, met, total := major(n)
 	if met > total/2 {
 		SiftUp(m)
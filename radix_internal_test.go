@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type pairs []PairStr
@@ -106,3 +107,147 @@ func TestCapture(t *testing.T) {
 		})
 	}
 }
+
+func TestLookupQueryOptional(t *testing.T) {
+	// Items are inserted with different order of nodes, thus optional key 3
+	// is met both above and below the node with key 1.
+	insert := []item{
+		{pairs{{1, "a"}, {3, "x"}}, 1},
+		{pairs{{3, "x"}, {1, "a"}}, 2},
+		{pairs{{3, "y"}, {1, "a"}}, 3},
+		{pairs{{1, "a"}}, 4},
+		{pairs{{1, "a"}, {3, "y"}}, 5},
+		{pairs{{1, "b"}, {3, "x"}}, 6},
+		{pairs{{3, "x"}}, 7},
+		{pairs{{3, "x"}, {2, "b"}, {1, "a"}}, 8},
+	}
+	for i, test := range []struct {
+		query    Query
+		strategy LookupStrategy
+		exp      map[uint]Wildcard
+	}{
+		{
+			query:    Query{}.Equal(1, []byte("a")).Equal(3, []byte("x")).Optional(3),
+			strategy: LookupStrategyStrict,
+			exp: map[uint]Wildcard{
+				1: {3: "x"},
+				2: {3: "x"},
+				4: {3: ""},
+			},
+		},
+		{
+			query:    Query{}.Equal(1, []byte("a")).NotEqual(3, []byte("x")).Optional(3),
+			strategy: LookupStrategyStrict,
+			exp: map[uint]Wildcard{
+				3: {3: "y"},
+				4: {3: ""},
+				5: {3: "y"},
+			},
+		},
+		{
+			query:    Query{}.Equal(3, []byte("x")).Optional(3),
+			strategy: LookupStrategyStrict,
+			exp: map[uint]Wildcard{
+				7: {3: "x"},
+			},
+		},
+		{
+			query:    Query{}.Equal(1, []byte("a")).Equal(3, []byte("x")).Optional(3),
+			strategy: LookupStrategyGreedy,
+			exp: map[uint]Wildcard{
+				1: {3: "x"},
+				2: {3: "x"},
+				4: {3: ""},
+				7: {3: "x"},
+			},
+		},
+	} {
+		t.Run(fmt.Sprintf("#%d", i), func(t *testing.T) {
+			root := NewLeaf(nil, "root")
+			for _, op := range insert {
+				(&Inserter{}).ForceInsert(root, PairStrToPair(op.p), op.v)
+			}
+
+			act := map[uint]Wildcard{}
+			LookupWildcardQuery(root, test.query, NewWildcard(3), test.strategy, func(w Wildcard, l *Leaf) bool {
+				for _, v := range l.AppendTo(nil) {
+					act[v] = w.Copy()
+				}
+				return true
+			})
+			if !reflect.DeepEqual(act, test.exp) {
+				t.Errorf("LookupWildcardQuery(%s) = %v; want %v", test.query, act, test.exp)
+			}
+
+			var items []uint
+			LookupQuery(root, test.query, test.strategy, func(l *Leaf) bool {
+				items = l.AppendTo(items)
+				return true
+			})
+			exp := make(map[uint]bool, len(test.exp))
+			for v := range test.exp {
+				exp[v] = true
+			}
+			for _, v := range items {
+				if !exp[v] {
+					t.Errorf("LookupQuery(%s) returned unexpected item %d", test.query, v)
+				}
+				delete(exp, v)
+			}
+			for v := range exp {
+				t.Errorf("LookupQuery(%s) did not return item %d", test.query, v)
+			}
+		})
+	}
+}
+
+func TestTrieVersionedRetention(t *testing.T) {
+	p := PathFromMapStr(map[uint]string{1: "a"})
+	for _, test := range []struct {
+		name   string
+		config TrieConfig
+		elapse time.Duration
+		kept   []uint64
+	}{
+		{
+			name:   "unlimited",
+			config: TrieConfig{Versioned: true},
+			kept:   []uint64{0, 1, 2, 3, 4, 5},
+		},
+		{
+			name:   "versions",
+			config: TrieConfig{Versioned: true, KeepVersions: 2},
+			kept:   []uint64{4, 5},
+		},
+		{
+			name:   "duration",
+			config: TrieConfig{Versioned: true, KeepDuration: time.Millisecond},
+			elapse: 10 * time.Millisecond,
+			// Version 4 was the latest one until version 5 is created.
+			kept: []uint64{4, 5},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Now()
+			trie := New(&test.config)
+			trie.history.now = func() time.Time {
+				return now
+			}
+			for i := uint(1); i <= 4; i++ {
+				trie.Insert(p, i)
+			}
+			now = now.Add(test.elapse)
+			trie.Insert(p, 5)
+
+			var kept []uint64
+			for v := uint64(0); v <= 5; v++ {
+				if _, err := trie.SnapshotAt(v); err == nil {
+					kept = append(kept, v)
+				}
+			}
+			if !reflect.DeepEqual(kept, test.kept) {
+				t.Errorf("kept versions = %v; want %v", kept, test.kept)
+			}
+		})
+	}
+}
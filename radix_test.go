@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"os"
 	"reflect"
+	"slices"
 	"strconv"
 	"testing"
 
@@ -748,3 +749,403 @@ func TestWilcardMethods(t *testing.T) {
 	}
 }
 
+type rule struct {
+	id   int
+	name string
+}
+
+func compareRules(a, b rule) int {
+	return a.id - b.id
+}
+
+func TestTrieOf(t *testing.T) {
+	trie := NewOf(&TrieConfig{NodeOrder: []uint{1}}, compareRules)
+
+	var (
+		r1 = rule{1, "first"}
+		r2 = rule{2, "second"}
+		r3 = rule{3, "third"}
+	)
+	trie.Insert(PathFromMapStr(map[uint]string{1: "a", 2: "b"}), r1)
+	trie.Insert(PathFromMapStr(map[uint]string{1: "a", 2: "b"}), r2)
+	trie.Insert(PathFromMapStr(map[uint]string{1: "a", 2: "c"}), r3)
+
+	var strict []rule
+	trie.LookupStrict(PathFromMapStr(map[uint]string{1: "a", 2: "b"}), func(r rule) bool {
+		strict = append(strict, r)
+		return true
+	})
+	if exp := []rule{r1, r2}; !reflect.DeepEqual(strict, exp) {
+		t.Errorf("LookupStrict() = %v; want %v", strict, exp)
+	}
+
+	selected := map[string]rule{}
+	trie.SelectGreedy(PathFromMapStr(map[uint]string{1: "a"}), NewWildcard(2), func(c Wildcard, r rule) bool {
+		selected[r.name] = r
+		if c[2] == "" {
+			t.Errorf("empty capture for %v", r)
+		}
+		return true
+	})
+	if n := len(selected); n != 3 {
+		t.Errorf("SelectGreedy() returned %d items; want 3", n)
+	}
+
+	if !trie.Delete(PathFromMapStr(map[uint]string{1: "a", 2: "b"}), rule{id: 2}) {
+		t.Errorf("Delete() = false; want true")
+	}
+	all := map[int]rule{}
+	trie.ForEach(Path{}, func(_ []PairStr, r rule) bool {
+		all[r.id] = r
+		return true
+	})
+	if exp := map[int]rule{1: r1, 3: r3}; !reflect.DeepEqual(all, exp) {
+		t.Errorf("ForEach() = %v; want %v", all, exp)
+	}
+}
+
+func TestTrieInsertWithPayload(t *testing.T) {
+	trie := New(nil)
+
+	ab := PathFromMapStr(map[uint]string{1: "a", 2: "b"})
+	a := PathFromMapStr(map[uint]string{1: "a"})
+
+	trie.InsertWithPayload(ab, 1, "ab-1")
+	trie.InsertWithPayload(a, 1, "a-1")
+	trie.InsertWithPayload(ab, 2, "ab-2")
+	trie.Insert(ab, 3)
+	// Payload must be replaced on repeated insertion.
+	trie.InsertWithPayload(ab, 2, "ab-2-new")
+
+	for i := uint(100); i < 100+LeafArrayCapacity; i++ {
+		trie.InsertWithPayload(a, i, i*2)
+	}
+
+	strict := map[uint]any{}
+	trie.LookupStrictWithPayload(ab, func(v uint, p any) bool {
+		strict[v] = p
+		return true
+	})
+	if exp := map[uint]any{1: "ab-1", 2: "ab-2-new", 3: nil}; !reflect.DeepEqual(strict, exp) {
+		t.Errorf("LookupStrictWithPayload() = %v; want %v", strict, exp)
+	}
+
+	greedy := map[string]int{}
+	trie.LookupGreedyWithPayload(ab, func(v uint, p any) bool {
+		switch x := p.(type) {
+		case string:
+			greedy[x]++
+		case uint:
+			if x != v*2 {
+				t.Errorf("unexpected payload for %d: %v", v, x)
+			}
+			greedy["btree"]++
+		}
+		return true
+	})
+	if exp := map[string]int{"ab-1": 1, "ab-2-new": 1, "a-1": 1, "btree": LeafArrayCapacity}; !reflect.DeepEqual(greedy, exp) {
+		t.Errorf("LookupGreedyWithPayload() = %v; want %v", greedy, exp)
+	}
+}
+
+func TestTrieIteratorsWithPayload(t *testing.T) {
+	trie := New(nil)
+
+	a := PathFromMapStr(map[uint]string{1: "a"})
+
+	trie.InsertWithPayload(a, 1, "a-1")
+	trie.InsertWithPayload(a, 2, "a-2")
+	Inserter{}.ForceInsertWithPayload(trie.Root(), PairStrToPair([]PairStr{{1, "a"}}), 3, "a-3")
+
+	exp := map[uint]any{1: "a-1", 2: "a-2", 3: "a-3"}
+	for _, test := range []struct {
+		name   string
+		lookup func(func(uint, any))
+	}{
+		{"SelectStrictWithPayload", func(fn func(uint, any)) {
+			trie.SelectStrictWithPayload(a, NewWildcard(2), func(_ Wildcard, v uint, p any) bool {
+				fn(v, p)
+				return true
+			})
+		}},
+		{"SelectGreedyWithPayload", func(fn func(uint, any)) {
+			trie.SelectGreedyWithPayload(a, NewWildcard(2), func(_ Wildcard, v uint, p any) bool {
+				fn(v, p)
+				return true
+			})
+		}},
+		{"LookupWildcardStrictWithPayload", func(fn func(uint, any)) {
+			trie.LookupWildcardStrictWithPayload(a, NewWildcard(2), func(_ Wildcard, v uint, p any) bool {
+				fn(v, p)
+				return true
+			})
+		}},
+		{"LookupWildcardGreedyWithPayload", func(fn func(uint, any)) {
+			trie.LookupWildcardGreedyWithPayload(a, NewWildcard(2), func(_ Wildcard, v uint, p any) bool {
+				fn(v, p)
+				return true
+			})
+		}},
+		{"ForEachWithPayload", func(fn func(uint, any)) {
+			trie.ForEachWithPayload(a, func(_ []PairStr, v uint, p any) bool {
+				fn(v, p)
+				return true
+			})
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			act := map[uint]any{}
+			test.lookup(func(v uint, p any) {
+				act[v] = p
+			})
+			if !reflect.DeepEqual(act, exp) {
+				t.Errorf("%s() = %v; want %v", test.name, act, exp)
+			}
+		})
+	}
+}
+
+func TestTrieMove(t *testing.T) {
+	trie := New(&TrieConfig{ReverseIndex: true})
+
+	a := PathFromMapStr(map[uint]string{1: "a"})
+	b := PathFromMapStr(map[uint]string{1: "b", 2: "c"})
+
+	trie.InsertWithPayload(a, 1, "payload")
+	if trie.Move(b, a, 1) {
+		t.Errorf("Move() of absent item = true; want false")
+	}
+	if !trie.Move(a, b, 1) {
+		t.Fatalf("Move() = false; want true")
+	}
+	var payload any
+	trie.LookupStrictWithPayload(b, func(v uint, p any) bool {
+		payload = p
+		return true
+	})
+	if payload != "payload" {
+		t.Errorf("payload after Move() is %v; want %q", payload, "payload")
+	}
+	if ps := trie.PathsOf(1); len(ps) != 1 || !ps[0].Equal(b) {
+		t.Errorf("PathsOf() after Move() = %v; want [%v]", ps, b)
+	}
+	if leafs, nodes := trie.SizeOf(Path{}); leafs != 2 || nodes != 2 {
+		t.Errorf("SizeOf() after Move() = %d, %d; want 2, 2", leafs, nodes)
+	}
+
+	trie.Insert(a, 2)
+	n := trie.MoveAll([]Relocation[uint]{
+		{From: b, To: a, Item: 1},
+		{From: a, To: b, Item: 2},
+		{From: a, To: b, Item: 3},
+	})
+	if n != 2 {
+		t.Errorf("MoveAll() = %d; want 2", n)
+	}
+	exp := map[uint]string{1: a.String(), 2: b.String()}
+	act := map[uint]string{}
+	trie.ForEach(Path{}, func(trace []PairStr, v uint) bool {
+		act[v] = PathFromSliceStr(trace).String()
+		return true
+	})
+	if !reflect.DeepEqual(act, exp) {
+		t.Errorf("after MoveAll() items are %v; want %v", act, exp)
+	}
+}
+
+func TestTrieMoveAtomic(t *testing.T) {
+	trie := New(nil)
+	paths := []Path{
+		PathFromMapStr(map[uint]string{1: "a"}),
+		PathFromMapStr(map[uint]string{2: "b", 3: "c"}),
+	}
+	trie.Insert(paths[0], 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			trie.Move(paths[i%2], paths[(i+1)%2], 1)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if n := trie.ItemCount(Path{}); n != 1 {
+			t.Fatalf("ItemCount() = %d during Move(); want 1", n)
+		}
+	}
+}
+
+func TestTrieMoveFromIterator(t *testing.T) {
+	trie := New(nil)
+	a := PathFromMapStr(map[uint]string{1: "a"})
+	b := PathFromMapStr(map[uint]string{1: "b"})
+	trie.Insert(a, 1)
+
+	trie.LookupStrict(a, func(v uint) bool {
+		// Move must not wait for the lookup to finish, as well as mutations
+		// made by the iterator must not wait for the Move.
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			trie.Move(a, b, 1)
+		}()
+		trie.Insert(a, 2)
+		<-done
+		return true
+	})
+	var act []uint
+	trie.LookupStrict(b, func(v uint) bool {
+		act = append(act, v)
+		return true
+	})
+	if exp := []uint{1}; !reflect.DeepEqual(act, exp) {
+		t.Errorf("after Move() items at %v are %v; want %v", b, act, exp)
+	}
+}
+
+func TestTrieMoveCleanup(t *testing.T) {
+	trie := New(nil)
+	var (
+		ab = PathFromMapStr(map[uint]string{1: "a", 2: "b"})
+		ac = PathFromMapStr(map[uint]string{1: "a", 2: "c"})
+		ax = PathFromMapStr(map[uint]string{1: "a", 3: "x"})
+	)
+	trie.Insert(ab, 1)
+	trie.Insert(ac, 2)
+	trie.Insert(ax, 3)
+	trie.Move(ab, ac, 1)
+
+	// Subtree of ax is shared by the leafs copied by Move. It must be
+	// removed from the trie once it becomes empty.
+	trie.Delete(ax, 3)
+	trie.Delete(ac, 1)
+	trie.Delete(ac, 2)
+	if leafs, nodes := trie.SizeOf(Path{}); leafs != 0 || nodes != 0 {
+		t.Errorf("SizeOf() of empty trie = %d, %d; want 0, 0", leafs, nodes)
+	}
+}
+
+func TestTrieLookupAny(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config *TrieConfig
+	}{
+		{"default", &TrieConfig{AnyKeys: []uint{1, 5}}},
+		{"order", &TrieConfig{AnyKeys: []uint{1, 5}, NodeOrder: []uint{5}}},
+		{"persistent", &TrieConfig{AnyKeys: []uint{1, 5}, Persistent: true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			trie := New(test.config)
+			trie.Insert(PathFromMapStr(map[uint]string{1: "a", 5: Any}), 1)
+			trie.Insert(PathFromMapStr(map[uint]string{1: "a", 5: "x"}), 2)
+			trie.Insert(PathFromMapStr(map[uint]string{1: Any, 5: Any}), 3)
+			trie.Insert(PathFromMapStr(map[uint]string{1: "b", 5: "y"}), 4)
+			trie.Insert(PathFromMapStr(map[uint]string{1: "b"}), 5)
+
+			lookup := func(m map[uint]string, s LookupStrategy) (ret []uint) {
+				q := PathFromMapStr(m)
+				it := func(v uint) bool {
+					ret = append(ret, v)
+					return true
+				}
+				switch s {
+				case LookupStrategyStrict:
+					trie.LookupStrict(q, it)
+				case LookupStrategyGreedy:
+					trie.LookupGreedy(q, it)
+				}
+				slices.Sort(ret)
+				return ret
+			}
+			for _, c := range []struct {
+				query map[uint]string
+				s     LookupStrategy
+				exp   []uint
+			}{
+				{map[uint]string{1: "a", 5: "x"}, LookupStrategyStrict, []uint{1, 2, 3}},
+				{map[uint]string{1: "a", 5: "y"}, LookupStrategyStrict, []uint{1, 3}},
+				{map[uint]string{1: "b", 5: "y"}, LookupStrategyStrict, []uint{3, 4}},
+				{map[uint]string{1: "b", 5: "y"}, LookupStrategyGreedy, []uint{3, 4, 5}},
+				{map[uint]string{1: "c", 5: Any}, LookupStrategyStrict, []uint{3}},
+			} {
+				if act := lookup(c.query, c.s); !reflect.DeepEqual(act, c.exp) {
+					t.Errorf("lookup(%v, %v) = %v; want %v", c.query, c.s, act, c.exp)
+				}
+			}
+
+			var act []uint
+			trie.SelectStrict(PathFromMapStr(map[uint]string{1: "a", 5: "x"}), nil, func(_ Wildcard, v uint) bool {
+				act = append(act, v)
+				return true
+			})
+			slices.Sort(act)
+			if exp := []uint{1, 2, 3}; !reflect.DeepEqual(act, exp) {
+				t.Errorf("SelectStrict() = %v; want %v", act, exp)
+			}
+
+			act = nil
+			q := NewQuery(PathFromMapStr(map[uint]string{1: "a"})).In(5, []byte("x"), []byte("y"))
+			trie.LookupQuery(q, LookupStrategyStrict, func(v uint) bool {
+				act = append(act, v)
+				return true
+			})
+			slices.Sort(act)
+			if exp := []uint{1, 2, 3}; !reflect.DeepEqual(act, exp) {
+				t.Errorf("LookupQuery(%s) = %v; want %v", q, act, exp)
+			}
+
+			// Delete must not remove item from the leaf with Any value.
+			if trie.Delete(PathFromMapStr(map[uint]string{1: "a", 5: "x"}), 1) {
+				t.Errorf("Delete() = true; want false")
+			}
+			if !trie.Delete(PathFromMapStr(map[uint]string{1: "a", 5: Any}), 1) {
+				t.Errorf("Delete() = false; want true")
+			}
+			if act, exp := lookup(map[uint]string{1: "a", 5: "x"}, LookupStrategyStrict), []uint{2, 3}; !reflect.DeepEqual(act, exp) {
+				t.Errorf("after Delete() items are %v; want %v", act, exp)
+			}
+		})
+	}
+}
+
+func TestTrieLookupAnyLiteral(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config *TrieConfig
+	}{
+		{"default", nil},
+		{"other keys", &TrieConfig{AnyKeys: []uint{2}}},
+		{"persistent", &TrieConfig{AnyKeys: []uint{2}, Persistent: true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			// Binary values equal to Any are matched by equality unless
+			// the key is listed in AnyKeys.
+			trie := New(test.config)
+			trie.Insert(PathFromMapStr(map[uint]string{1: "\xff"}), 1)
+			trie.Insert(PathFromMapStr(map[uint]string{1: "\x01"}), 2)
+
+			for _, c := range []struct {
+				value string
+				exp   []uint
+			}{
+				{"\x01", []uint{2}},
+				{"\xff", []uint{1}},
+				{"\x02", nil},
+			} {
+				var act []uint
+				trie.LookupStrict(PathFromMapStr(map[uint]string{1: c.value}), func(v uint) bool {
+					act = append(act, v)
+					return true
+				})
+				if !reflect.DeepEqual(act, c.exp) {
+					t.Errorf("lookup(%q) = %v; want %v", c.value, act, c.exp)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,527 @@
+package radix
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Replication stream is as follows:
+//
+//	stream    = magic version *message
+//	message   = snapshot / record / heartbeat
+//	snapshot  = %x01 uvarint(seq) trie
+//	record    = %x02 uvarint(head) bytes(event) checksum
+//	heartbeat = %x03 uvarint(head)
+//	event     = uvarint(seq) kind path item payload
+//	kind      = %x00 (insert) / %x01 (delete)
+//	payload   = %x00 / %x01 bytes
+//	checksum  = uint32 CRC-32C of event in big endian
+//
+// Trie is written as EncoderOf does. Seq of the snapshot is a sequence number
+// of the last change it contains. Head is a sequence number of the last
+// change known by the leader at the moment of writing.
+const (
+	replicationMagic   = "RDXR"
+	replicationVersion = 1
+)
+
+const (
+	replicationSnapshot byte = iota + 1
+	replicationRecord
+	replicationHeartbeat
+)
+
+var (
+	// ErrLeaderClosed is returned by LeaderOf.Serve when leader is closed.
+	ErrLeaderClosed = errors.New("radix: leader is closed")
+
+	// ErrReplicationGap is returned by FollowerOf.Run when received change
+	// does not follow the last applied one.
+	ErrReplicationGap = errors.New("radix: replication gap")
+)
+
+const (
+	defaultLeaderBacklog   = 4096
+	defaultLeaderHeartbeat = time.Second
+)
+
+// LeaderConfig contains options of replication leader.
+type LeaderConfig struct {
+	// Backlog is a number of the recent changes kept by the leader to resume
+	// replication without sending the whole trie. Zero means 4096.
+	Backlog int
+
+	// Heartbeat is an interval of heartbeat messages which let followers know
+	// that they are up to date. Zero means one second.
+	Heartbeat time.Duration
+
+	// EncodePayload is used to encode non-nil item payloads. If it is nil,
+	// replication of a trie with payloads fails.
+	EncodePayload func(any) ([]byte, error)
+}
+
+// Leader is a LeaderOf uint items.
+type Leader = LeaderOf[uint]
+
+// LeaderOf writes trie of items of type T and its changes to followers.
+// Items must be of one of the predeclared integer types.
+type LeaderOf[T any] struct {
+	trie      *TrieOf[T]
+	sub       *SubscriptionOf[T]
+	conv      itemConv[T]
+	backlog   int
+	heartbeat time.Duration
+	encode    func(any) ([]byte, error)
+
+	mu      sync.Mutex
+	events  []EventOf[T]
+	head    uint64
+	notify  chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewLeader creates replication leader of uint items trie.
+func NewLeader(t *Trie, config *LeaderConfig) *Leader {
+	return NewLeaderOf(t, config)
+}
+
+// NewLeaderOf creates replication leader of the trie of items of type T.
+// Leader must be closed when it is no longer needed.
+//
+// Note that leader subscribes to the trie changes. See TrieOf.Subscribe().
+func NewLeaderOf[T any](t *TrieOf[T], config *LeaderConfig) *LeaderOf[T] {
+	conv, ok := itemConvOf[T]()
+	if !ok {
+		panic(fmt.Sprintf("radix: could not replicate items of type %T", *new(T)))
+	}
+	var c LeaderConfig
+	if config != nil {
+		c = *config
+	}
+	if c.Backlog <= 0 {
+		c.Backlog = defaultLeaderBacklog
+	}
+	if c.Heartbeat <= 0 {
+		c.Heartbeat = defaultLeaderHeartbeat
+	}
+	l := &LeaderOf[T]{
+		trie:      t,
+		conv:      conv,
+		backlog:   c.Backlog,
+		heartbeat: c.Heartbeat,
+		encode:    c.EncodePayload,
+		notify:    make(chan struct{}),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	l.sub, l.head = t.subscribe(SubscriptionConfig{
+		Policy: SlowConsumerBlock,
+	})
+	go l.receive()
+	return l
+}
+
+// Close stops the leader. All running Serve calls return ErrLeaderClosed.
+func (l *LeaderOf[T]) Close() {
+	l.sub.Close()
+	<-l.stopped
+}
+
+func (l *LeaderOf[T]) receive() {
+	defer close(l.stopped)
+	defer close(l.done)
+	for e := range l.sub.Events() {
+		l.mu.Lock()
+		if n := len(l.events); n == 2*l.backlog {
+			l.events = append(l.events[:0], l.events[n-l.backlog:]...)
+		}
+		l.events = append(l.events, e)
+		l.head = e.Seq
+		close(l.notify)
+		l.notify = make(chan struct{})
+		l.mu.Unlock()
+	}
+}
+
+// since returns changes with sequence numbers starting from seq. It returns
+// false if some of them are no longer kept.
+func (l *LeaderOf[T]) since(seq uint64) (events []EventOf[T], head uint64, notify chan struct{}, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	first := l.head + 1
+	if len(l.events) > 0 {
+		first = l.events[0].Seq
+	}
+	if seq < first {
+		return nil, l.head, l.notify, false
+	}
+	if i := int(seq - first); i < len(l.events) {
+		events = append(events, l.events[i:]...)
+	}
+	return events, l.head, l.notify, true
+}
+
+// Serve writes trie changes made after the one with sequence number from to
+// w until error occurs or leader is closed. If such changes are no longer
+// kept by the leader (or from is zero), it writes the whole trie first.
+//
+// Serve could be called by multiple goroutines for different followers.
+func (l *LeaderOf[T]) Serve(w io.Writer, from uint64) error {
+	var (
+		bw  = bufio.NewWriter(w)
+		buf []byte
+	)
+	buf = append(buf, replicationMagic...)
+	buf = append(buf, replicationVersion)
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+
+	heartbeat := time.NewTicker(l.heartbeat)
+	defer heartbeat.Stop()
+
+	next := from + 1
+	_, head, _, ok := l.since(next)
+	resync := from == 0 || from > head || !ok
+	for {
+		if resync {
+			seq, err := l.writeSnapshot(bw)
+			if err != nil {
+				return err
+			}
+			next = seq + 1
+			resync = false
+		}
+		events, head, notify, ok := l.since(next)
+		if !ok {
+			// Follower is too slow.
+			resync = true
+			continue
+		}
+		for _, e := range events {
+			var err error
+			if buf, err = l.appendRecord(buf[:0], head, e); err != nil {
+				return err
+			}
+			if _, err := bw.Write(buf); err != nil {
+				return err
+			}
+			next = e.Seq + 1
+		}
+		if len(events) > 0 {
+			continue
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		select {
+		case <-notify:
+		case <-heartbeat.C:
+			buf = append(buf[:0], replicationHeartbeat)
+			buf = binary.AppendUvarint(buf, head)
+			if _, err := bw.Write(buf); err != nil {
+				return err
+			}
+		case <-l.done:
+			return ErrLeaderClosed
+		}
+	}
+}
+
+// ServeConn reads sequence number written by FollowerOf.RunConn from conn
+// and then calls Serve with it.
+func (l *LeaderOf[T]) ServeConn(conn io.ReadWriter) error {
+	var p [8]byte
+	if _, err := io.ReadFull(conn, p[:]); err != nil {
+		return err
+	}
+	return l.Serve(conn, binary.BigEndian.Uint64(p[:]))
+}
+
+func (l *LeaderOf[T]) writeSnapshot(w *bufio.Writer) (seq uint64, err error) {
+	s, seq := l.trie.snapshotSeq()
+	var buf []byte
+	buf = append(buf, replicationSnapshot)
+	buf = binary.AppendUvarint(buf, seq)
+	if _, err := w.Write(buf); err != nil {
+		return 0, err
+	}
+	enc := NewEncoderOf[T](w)
+	enc.EncodePayload = l.encode
+	if err := enc.Encode(s); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+func (l *LeaderOf[T]) appendRecord(b []byte, head uint64, e EventOf[T]) ([]byte, error) {
+	var p []byte
+	if e.Payload != nil {
+		if l.encode == nil {
+			return nil, fmt.Errorf("radix: could not replicate payload of %v: EncodePayload is not set", e.Item)
+		}
+		var err error
+		if p, err = l.encode(e.Payload); err != nil {
+			return nil, fmt.Errorf("radix: could not replicate payload of %v: %w", e.Item, err)
+		}
+	}
+	var event []byte
+	event = binary.AppendUvarint(event, e.Seq)
+	event = append(event, byte(e.Kind))
+	event = appendPath(event, e.Path)
+	event = binary.AppendUvarint(event, zigzag(l.conv.to(e.Item)))
+	if e.Payload == nil {
+		event = append(event, 0)
+	} else {
+		event = append(event, 1)
+		event = binary.AppendUvarint(event, uint64(len(p)))
+		event = append(event, p...)
+	}
+
+	b = append(b, replicationRecord)
+	b = binary.AppendUvarint(b, head)
+	b = binary.AppendUvarint(b, uint64(len(event)))
+	b = append(b, event...)
+	b = binary.BigEndian.AppendUint32(b, crc32.Checksum(event, crcTable))
+	return b, nil
+}
+
+// snapshotSeq returns read-only copy of the trie along with sequence number
+// of the last change it contains.
+func (t *TrieOf[T]) snapshotSeq() (*TrieOf[T], uint64) {
+	t.beginWrite(true)
+	defer t.endWrite(true)
+
+	root := t.writeRoot()
+	if !t.persistent {
+		root = cloneTree(root, nil)
+	}
+	s := &TrieOf[T]{
+		inserter:   t.inserter,
+		persistent: true,
+		readonly:   true,
+	}
+	s.root.Store(root)
+	return s, t.feed.seq
+}
+
+// Follower is a FollowerOf uint items.
+type Follower = FollowerOf[uint]
+
+// FollowerOf applies changes written by LeaderOf to the trie of items of
+// type T.
+type FollowerOf[T any] struct {
+	// DecodePayload is used to decode item payloads. If it is nil,
+	// replication of a trie with payloads fails.
+	DecodePayload func([]byte) (any, error)
+
+	trie *TrieOf[T]
+	seq  atomic.Uint64
+	head atomic.Uint64
+}
+
+// NewFollower creates replication follower of uint items trie.
+func NewFollower(t *Trie) *Follower {
+	return NewFollowerOf(t)
+}
+
+// NewFollowerOf creates replication follower applying changes to t.
+// Note that changes are applied one by one; that is, readers of t could see
+// the mutations of leader which are atomic (like Move) partially applied.
+func NewFollowerOf[T any](t *TrieOf[T]) *FollowerOf[T] {
+	return &FollowerOf[T]{
+		trie: t,
+	}
+}
+
+// Seq returns sequence number of the last applied change. It should be
+// passed to LeaderOf.Serve to resume replication after reconnect.
+func (f *FollowerOf[T]) Seq() uint64 {
+	return f.seq.Load()
+}
+
+// Lag returns number of changes made by the leader which are not yet applied
+// by the follower. It is computed with respect to the latest leader state
+// known by the follower.
+func (f *FollowerOf[T]) Lag() uint64 {
+	head, seq := f.head.Load(), f.seq.Load()
+	if head < seq {
+		return 0
+	}
+	return head - seq
+}
+
+// RunConn writes Seq() to conn for LeaderOf.ServeConn and then calls Run
+// with it.
+func (f *FollowerOf[T]) RunConn(conn io.ReadWriter) error {
+	var p [8]byte
+	binary.BigEndian.PutUint64(p[:], f.Seq())
+	if _, err := conn.Write(p[:]); err != nil {
+		return err
+	}
+	return f.Run(conn)
+}
+
+// Run reads stream written by LeaderOf.Serve from r and applies it to the
+// trie. It returns nil when r is exhausted between the messages.
+func (f *FollowerOf[T]) Run(r io.Reader) error {
+	conv, ok := itemConvOf[T]()
+	if !ok {
+		return fmt.Errorf("radix: could not replicate items of type %T", *new(T))
+	}
+	br := bufio.NewReader(r)
+	header := make([]byte, len(replicationMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return replicationError(err)
+	}
+	if string(header[:len(replicationMagic)]) != replicationMagic {
+		return fmt.Errorf("%w: bad replication magic %q", ErrInvalidFormat, header[:len(replicationMagic)])
+	}
+	if v := header[len(replicationMagic)]; v != replicationVersion {
+		return fmt.Errorf("%w: unsupported replication version %d", ErrInvalidFormat, v)
+	}
+	for {
+		kind, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case replicationSnapshot:
+			seq, err := binary.ReadUvarint(br)
+			if err != nil {
+				return replicationError(err)
+			}
+			dec := NewDecoderOf[T](br)
+			dec.DecodePayload = f.DecodePayload
+			if err := dec.Decode(f.trie); err != nil {
+				return replicationError(err)
+			}
+			f.seq.Store(seq)
+			if f.head.Load() < seq {
+				f.head.Store(seq)
+			}
+
+		case replicationRecord:
+			head, err := binary.ReadUvarint(br)
+			if err != nil {
+				return replicationError(err)
+			}
+			f.head.Store(head)
+			e, err := f.readEvent(br, conv)
+			if err != nil {
+				return replicationError(err)
+			}
+			if seq := f.seq.Load(); e.Seq != seq+1 {
+				return fmt.Errorf("%w: received change #%d after #%d", ErrReplicationGap, e.Seq, seq)
+			}
+			f.apply(e)
+			f.seq.Store(e.Seq)
+
+		case replicationHeartbeat:
+			head, err := binary.ReadUvarint(br)
+			if err != nil {
+				return replicationError(err)
+			}
+			f.head.Store(head)
+
+		default:
+			return fmt.Errorf("%w: unknown replication message: %#x", ErrInvalidFormat, kind)
+		}
+	}
+}
+
+func (f *FollowerOf[T]) readEvent(r *bufio.Reader, conv itemConv[T]) (e EventOf[T], err error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return e, err
+	}
+	var data bytes.Buffer
+	if m, err := io.CopyN(&data, r, int64(n)); m < int64(n) {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return e, err
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return e, err
+	}
+	if crc32.Checksum(data.Bytes(), crcTable) != binary.BigEndian.Uint32(sum[:]) {
+		return e, ErrChecksum
+	}
+
+	br := bytes.NewReader(data.Bytes())
+	if e.Seq, err = binary.ReadUvarint(br); err != nil {
+		return e, err
+	}
+	kind, err := br.ReadByte()
+	if err != nil {
+		return e, err
+	}
+	if e.Kind = EventKind(kind); e.Kind != EventInsert && e.Kind != EventDelete {
+		return e, fmt.Errorf("%w: unknown change kind: %#x", ErrInvalidFormat, kind)
+	}
+	if e.Path, err = readPath(br); err != nil {
+		return e, err
+	}
+	x, err := binary.ReadUvarint(br)
+	if err != nil {
+		return e, err
+	}
+	e.Item = conv.from(unzigzag(x))
+	hasPayload, err := br.ReadByte()
+	if err != nil {
+		return e, err
+	}
+	if hasPayload != 0 {
+		p, err := readBytes(br)
+		if err != nil {
+			return e, err
+		}
+		if f.DecodePayload == nil {
+			return e, fmt.Errorf("radix: could not decode payload of %v: DecodePayload is not set", e.Item)
+		}
+		if e.Payload, err = f.DecodePayload(p); err != nil {
+			return e, fmt.Errorf("radix: could not decode payload of %v: %w", e.Item, err)
+		}
+	}
+	if br.Len() > 0 {
+		return e, fmt.Errorf("%w: trailing data of change #%d", ErrInvalidFormat, e.Seq)
+	}
+	return e, nil
+}
+
+func (f *FollowerOf[T]) apply(e EventOf[T]) {
+	t := f.trie
+	t.beginWrite(true)
+	defer t.endWrite(true)
+
+	switch e.Kind {
+	case EventInsert:
+		t.insertExact(e.Path, e.Item, e.Payload)
+	case EventDelete:
+		t.remove(nil, e.Path, e.Item, true)
+	}
+}
+
+func replicationError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %w", ErrInvalidFormat, io.ErrUnexpectedEOF)
+	}
+	return err
+}
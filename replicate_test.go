@@ -0,0 +1,152 @@
+package radix_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/gobwas/radix"
+)
+
+func TestReplication(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		backlog int
+	}{
+		{"resume", 0},
+		{"resync", 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			leader := New(&TrieConfig{Persistent: true})
+			entries := randEntries(300)
+			for _, e := range entries[:100] {
+				leader.InsertWithPayload(e.Path, e.Item, e.Payload)
+			}
+			l := NewLeader(leader, &LeaderConfig{
+				Backlog:       test.backlog,
+				Heartbeat:     time.Millisecond,
+				EncodePayload: encodeIntPayload,
+			})
+			defer l.Close()
+
+			follower := New(nil)
+			f := NewFollower(follower)
+			f.DecodePayload = decodeIntPayload
+
+			connect := func() (disconnect func()) {
+				lc, fc := net.Pipe()
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					f.RunConn(fc)
+				}()
+				go l.ServeConn(lc)
+				return func() {
+					lc.Close()
+					fc.Close()
+					<-done
+				}
+			}
+
+			disconnect := connect()
+			for i, e := range entries[100:200] {
+				leader.InsertWithPayload(e.Path, e.Item, e.Payload)
+				if i%3 == 0 {
+					leader.Delete(entries[i].Path, entries[i].Item)
+				}
+			}
+			waitReplicated(t, leader, follower, f)
+			disconnect()
+
+			seq := f.Seq()
+			for _, e := range entries[200:] {
+				leader.Move(e.Path, PathFromMapStr(map[uint]string{7: "moved"}), e.Item)
+				leader.InsertWithPayload(e.Path, e.Item, e.Payload)
+			}
+			disconnect = connect()
+			defer disconnect()
+			waitReplicated(t, leader, follower, f)
+			if f.Seq() <= seq {
+				t.Errorf("Seq() = %d after reconnect; want greater than %d", f.Seq(), seq)
+			}
+		})
+	}
+}
+
+func TestReplicationBuffer(t *testing.T) {
+	leader := New(nil)
+	l := NewLeader(leader, nil)
+	p := PathFromMapStr(map[uint]string{1: "a"})
+	leader.Insert(p, 1)
+
+	var (
+		buf  bytes.Buffer
+		done = make(chan error)
+	)
+	go func() {
+		done <- l.Serve(&buf, 0)
+	}()
+	// Let Serve write the snapshot first.
+	time.Sleep(10 * time.Millisecond)
+	leader.Insert(p, 2)
+	leader.Delete(p, 1)
+	time.Sleep(10 * time.Millisecond)
+	l.Close()
+	if err := <-done; !errors.Is(err, ErrLeaderClosed) {
+		t.Fatalf("Serve() error = %v; want %v", err, ErrLeaderClosed)
+	}
+
+	follower := New(nil)
+	f := NewFollower(follower)
+	if err := f.Run(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := trieItems(follower), trieItems(leader); !reflect.DeepEqual(a, b) {
+		t.Errorf("follower items = %v; want %v", a, b)
+	}
+	if seq, lag := f.Seq(), f.Lag(); seq != 3 || lag != 0 {
+		t.Errorf("Seq(), Lag() = %d, %d; want 3, 0", seq, lag)
+	}
+
+	// Resumed stream could not be applied to the empty follower.
+	l = NewLeader(leader, nil)
+	leader.Insert(p, 3)
+	buf.Reset()
+	go func() {
+		done <- l.Serve(&buf, 3)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	l.Close()
+	<-done
+	err := NewFollower(New(nil)).Run(bytes.NewReader(buf.Bytes()))
+	if !errors.Is(err, ErrReplicationGap) {
+		t.Errorf("Run() error = %v; want %v", err, ErrReplicationGap)
+	}
+}
+
+func waitReplicated(t *testing.T, leader, follower *Trie, f *Follower) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		exp := trieItems(leader)
+		act := trieItems(follower)
+		if f.Lag() == 0 && reflect.DeepEqual(act, exp) {
+			if a, b := canonicalPayloads(follower), canonicalPayloads(leader); !reflect.DeepEqual(a, b) {
+				t.Fatalf("follower payloads = %v; want %v", a, b)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("follower items = %v; want %v (lag %d)", act, exp, f.Lag())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func decodeIntPayload(p []byte) (any, error) {
+	return strconv.Atoi(string(p))
+}
@@ -0,0 +1,205 @@
+package radix
+
+import (
+	"cmp"
+	"math/rand/v2"
+)
+
+// treap is a persistent map ordered by keys. Its nodes are never changed once
+// created: every mutation returns a new map which shares unchanged nodes with
+// the original one. Thus map could be copied in O(1) and read without locking
+// while the next version of it is being made.
+type treap[K cmp.Ordered, V any] struct {
+	root *treapNode[K, V]
+}
+
+type treapNode[K cmp.Ordered, V any] struct {
+	key   K
+	value V
+	prio  uint32
+	size  int
+
+	left, right *treapNode[K, V]
+}
+
+func (n *treapNode[K, V]) len() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *treapNode[K, V]) update() {
+	n.size = 1 + n.left.len() + n.right.len()
+}
+
+// Len returns number of keys in the map.
+func (t treap[K, V]) Len() int {
+	return t.root.len()
+}
+
+// Get returns value associated with k.
+func (t treap[K, V]) Get(k K) (v V, ok bool) {
+	n := t.root
+	for n != nil {
+		switch c := cmp.Compare(k, n.key); {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n.value, true
+		}
+	}
+	return v, false
+}
+
+// Set returns map where k is associated with v.
+func (t treap[K, V]) Set(k K, v V) treap[K, V] {
+	if root, ok := replaceTreap(t.root, k, v); ok {
+		return treap[K, V]{root}
+	}
+	l, r := splitTreap(t.root, k)
+	n := &treapNode[K, V]{
+		key:   k,
+		value: v,
+		prio:  rand.Uint32(),
+		size:  1,
+	}
+	return treap[K, V]{mergeTreaps(mergeTreaps(l, n), r)}
+}
+
+// Delete returns map without k. It also returns value associated with k.
+func (t treap[K, V]) Delete(k K) (_ treap[K, V], v V, ok bool) {
+	root, v, ok := deleteTreap(t.root, k)
+	return treap[K, V]{root}, v, ok
+}
+
+// Max returns the greatest key of the map. It returns zero value of K if the
+// map is empty.
+func (t treap[K, V]) Max() (k K) {
+	for n := t.root; n != nil; n = n.right {
+		k = n.key
+	}
+	return k
+}
+
+// Ascend calls it for every key and value in ascending order of keys.
+func (t treap[K, V]) Ascend(it func(K, V) bool) bool {
+	return t.root.ascend(it)
+}
+
+// AscendRange is like Ascend, but only calls it for keys within [lo, hi].
+func (t treap[K, V]) AscendRange(lo, hi K, it func(K, V) bool) bool {
+	return t.root.ascendRange(lo, hi, it)
+}
+
+func (n *treapNode[K, V]) ascend(it func(K, V) bool) bool {
+	for n != nil {
+		if !n.left.ascend(it) || !it(n.key, n.value) {
+			return false
+		}
+		n = n.right
+	}
+	return true
+}
+
+func (n *treapNode[K, V]) ascendRange(lo, hi K, it func(K, V) bool) bool {
+	for n != nil {
+		switch {
+		case cmp.Less(n.key, lo):
+			n = n.right
+		case cmp.Less(hi, n.key):
+			n = n.left
+		default:
+			if !n.left.ascendRange(lo, hi, it) || !it(n.key, n.value) {
+				return false
+			}
+			n = n.right
+		}
+	}
+	return true
+}
+
+// replaceTreap returns copy of the subtree where existing k is associated with
+// v. It returns false if there is no k in the subtree.
+func replaceTreap[K cmp.Ordered, V any](n *treapNode[K, V], k K, v V) (*treapNode[K, V], bool) {
+	if n == nil {
+		return nil, false
+	}
+	cp := *n
+	switch c := cmp.Compare(k, n.key); {
+	case c < 0:
+		l, ok := replaceTreap(n.left, k, v)
+		if !ok {
+			return n, false
+		}
+		cp.left = l
+	case c > 0:
+		r, ok := replaceTreap(n.right, k, v)
+		if !ok {
+			return n, false
+		}
+		cp.right = r
+	default:
+		cp.value = v
+	}
+	return &cp, true
+}
+
+// splitTreap splits the subtree into keys less than k and the rest.
+func splitTreap[K cmp.Ordered, V any](n *treapNode[K, V], k K) (l, r *treapNode[K, V]) {
+	if n == nil {
+		return nil, nil
+	}
+	cp := *n
+	if cmp.Less(n.key, k) {
+		cp.right, r = splitTreap(n.right, k)
+		cp.update()
+		return &cp, r
+	}
+	l, cp.left = splitTreap(n.left, k)
+	cp.update()
+	return l, &cp
+}
+
+// mergeTreaps merges subtrees where all keys of l are less than keys of r.
+func mergeTreaps[K cmp.Ordered, V any](l, r *treapNode[K, V]) *treapNode[K, V] {
+	switch {
+	case l == nil:
+		return r
+	case r == nil:
+		return l
+	case l.prio > r.prio:
+		cp := *l
+		cp.right = mergeTreaps(l.right, r)
+		cp.update()
+		return &cp
+	default:
+		cp := *r
+		cp.left = mergeTreaps(l, r.left)
+		cp.update()
+		return &cp
+	}
+}
+
+func deleteTreap[K cmp.Ordered, V any](n *treapNode[K, V], k K) (_ *treapNode[K, V], v V, ok bool) {
+	if n == nil {
+		return nil, v, false
+	}
+	cp := *n
+	switch c := cmp.Compare(k, n.key); {
+	case c < 0:
+		if cp.left, v, ok = deleteTreap(n.left, k); !ok {
+			return n, v, false
+		}
+	case c > 0:
+		if cp.right, v, ok = deleteTreap(n.right, k); !ok {
+			return n, v, false
+		}
+	default:
+		return mergeTreaps(n.left, n.right), n.value, true
+	}
+	cp.update()
+	return &cp, v, true
+}
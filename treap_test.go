@@ -0,0 +1,77 @@
+package radix
+
+import (
+	"maps"
+	"math/rand"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestTreap(t *testing.T) {
+	var (
+		tr       treap[int, int]
+		versions []treap[int, int]
+		expect   []map[int]int
+	)
+	m := make(map[int]int)
+	r := rand.New(rand.NewSource(0))
+	for i := 0; i < 1000; i++ {
+		k := r.Intn(100)
+		if r.Intn(3) == 0 {
+			var ok bool
+			tr, _, ok = tr.Delete(k)
+			if _, has := m[k]; has != ok {
+				t.Fatalf("Delete(%d) = %t; want %t", k, ok, has)
+			}
+			delete(m, k)
+		} else {
+			tr = tr.Set(k, i)
+			m[k] = i
+		}
+		if i%100 == 0 {
+			versions = append(versions, tr)
+			expect = append(expect, maps.Clone(m))
+		}
+	}
+	versions = append(versions, tr)
+	expect = append(expect, m)
+
+	for i, tr := range versions {
+		act := make(map[int]int)
+		var keys []int
+		tr.Ascend(func(k, v int) bool {
+			act[k] = v
+			keys = append(keys, k)
+			return true
+		})
+		if !reflect.DeepEqual(act, expect[i]) {
+			t.Errorf("[%d] unexpected contents: %v; want %v", i, act, expect[i])
+		}
+		if !slices.IsSorted(keys) {
+			t.Errorf("[%d] keys are not sorted: %v", i, keys)
+		}
+		if n := tr.Len(); n != len(expect[i]) {
+			t.Errorf("[%d] Len() = %d; want %d", i, n, len(expect[i]))
+		}
+		for k, v := range expect[i] {
+			if act, ok := tr.Get(k); !ok || act != v {
+				t.Errorf("[%d] Get(%d) = %d, %t; want %d", i, k, act, ok, v)
+			}
+		}
+		var rng []int
+		tr.AscendRange(10, 20, func(k, _ int) bool {
+			rng = append(rng, k)
+			return true
+		})
+		want := slices.DeleteFunc(slices.Clone(keys), func(k int) bool {
+			return k < 10 || k > 20
+		})
+		if !slices.Equal(rng, want) {
+			t.Errorf("[%d] AscendRange(10, 20) reported %v; want %v", i, rng, want)
+		}
+		if len(keys) > 0 && tr.Max() != keys[len(keys)-1] {
+			t.Errorf("[%d] Max() = %d; want %d", i, tr.Max(), keys[len(keys)-1])
+		}
+	}
+}
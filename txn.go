@@ -0,0 +1,210 @@
+package radix
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTxnDone is returned by Commit when transaction is already committed
+	// or rolled back.
+	ErrTxnDone = errors.New("radix: transaction is already committed or rolled back")
+
+	// ErrNotFound is returned when operation refers to item that is not
+	// present at given path.
+	ErrNotFound = errors.New("radix: item not found")
+)
+
+// Txn is a TxnOf uint items.
+type Txn = TxnOf[uint]
+
+// TxnOf collects trie mutations to apply them at once.
+//
+// Mutations are not visible to readers until Commit is called. Commit applies
+// either all of them or none. TxnOf is not safe for concurrent use.
+type TxnOf[T any] struct {
+	trie *TrieOf[T]
+	ops  []txnOp[T]
+	done bool
+}
+
+type txnOpKind uint8
+
+const (
+	txnInsert txnOpKind = iota
+	txnDelete
+	txnMove
+)
+
+func (k txnOpKind) String() string {
+	switch k {
+	case txnInsert:
+		return "insert"
+	case txnDelete:
+		return "delete"
+	case txnMove:
+		return "move"
+	default:
+		return "unknown"
+	}
+}
+
+type txnOp[T any] struct {
+	kind    txnOpKind
+	path    Path
+	to      Path
+	item    T
+	payload any
+}
+
+// Txn starts new transaction.
+func (t *TrieOf[T]) Txn() *TxnOf[T] {
+	return &TxnOf[T]{trie: t}
+}
+
+// Insert adds insertion of v at path p to the transaction.
+func (x *TxnOf[T]) Insert(p Path, v T) {
+	x.InsertWithPayload(p, v, nil)
+}
+
+// InsertWithPayload adds insertion of v with payload at path p to the
+// transaction.
+func (x *TxnOf[T]) InsertWithPayload(p Path, v T, payload any) {
+	x.ops = append(x.ops, txnOp[T]{
+		kind:    txnInsert,
+		path:    clonePath(p),
+		item:    v,
+		payload: payload,
+	})
+}
+
+// Delete adds deletion of v at path p to the transaction.
+// Commit fails if v is not present at p at the moment of deletion.
+func (x *TxnOf[T]) Delete(p Path, v T) {
+	x.ops = append(x.ops, txnOp[T]{
+		kind: txnDelete,
+		path: clonePath(p),
+		item: v,
+	})
+}
+
+// Move adds movement of v from oldPath to newPath to the transaction.
+// Commit fails if v is not present at oldPath at the moment of movement.
+func (x *TxnOf[T]) Move(oldPath, newPath Path, v T) {
+	x.ops = append(x.ops, txnOp[T]{
+		kind: txnMove,
+		path: clonePath(oldPath),
+		to:   clonePath(newPath),
+		item: v,
+	})
+}
+
+// Len returns number of operations collected by transaction.
+func (x *TxnOf[T]) Len() int {
+	return len(x.ops)
+}
+
+// Rollback discards all collected operations.
+func (x *TxnOf[T]) Rollback() {
+	x.ops = nil
+	x.done = true
+}
+
+// Commit validates and applies collected operations in order they were
+// added. Readers which use trie methods see either none or all of the
+// operations applied.
+//
+// If some delete or move operation refers to an item which is not present at
+// that moment (with respect to preceding operations of the transaction),
+// Commit returns an error wrapping ErrNotFound and trie is left untouched.
+func (x *TxnOf[T]) Commit() error {
+	if x.done {
+		return ErrTxnDone
+	}
+	x.done = true
+
+	t := x.trie
+	t.beginWrite(true)
+	defer t.endWrite(true)
+
+	if err := x.validate(); err != nil {
+		return err
+	}
+	for _, op := range x.ops {
+		switch op.kind {
+		case txnInsert:
+			t.insertTo(nil, op.path, op.item, op.payload)
+		case txnDelete:
+			t.deleteFrom(nil, op.path, op.item)
+		case txnMove:
+			t.move(nil, op.path, op.to, op.item)
+		}
+	}
+	x.ops = nil
+
+	return nil
+}
+
+// validate checks that operations could be applied.
+// Caller must be between trie's beginWrite and endWrite calls.
+func (x *TxnOf[T]) validate() error {
+	s := txnState[T]{
+		trie:    x.trie,
+		overlay: make(map[string][]txnItem[T]),
+	}
+	for i, op := range x.ops {
+		switch op.kind {
+		case txnInsert:
+			s.set(op.path, op.item, true)
+		case txnDelete, txnMove:
+			if !s.has(op.path, op.item) {
+				return fmt.Errorf(
+					"radix: transaction operation #%d: %s of %v at %v: %w",
+					i, op.kind, op.item, op.path, ErrNotFound,
+				)
+			}
+			s.set(op.path, op.item, false)
+			if op.kind == txnMove {
+				s.set(op.to, op.item, true)
+			}
+		}
+	}
+	return nil
+}
+
+// txnState tracks items presence changed by transaction operations.
+type txnState[T any] struct {
+	trie    *TrieOf[T]
+	overlay map[string][]txnItem[T]
+}
+
+type txnItem[T any] struct {
+	item    T
+	present bool
+}
+
+func (s *txnState[T]) has(p Path, v T) (ok bool) {
+	root := s.trie.writeRoot()
+	for _, x := range s.overlay[pathKey(p)] {
+		if root.cmp(x.item, v) == 0 {
+			return x.present
+		}
+	}
+	lookup(root, p, LookupStrategyStrict, true, func(l *LeafOf[T]) bool {
+		_, ok = l.Payload(v)
+		return !ok
+	})
+	return ok
+}
+
+func (s *txnState[T]) set(p Path, v T, present bool) {
+	k := pathKey(p)
+	items := s.overlay[k]
+	for i, x := range items {
+		if s.trie.writeRoot().cmp(x.item, v) == 0 {
+			items[i].present = present
+			return
+		}
+	}
+	s.overlay[k] = append(items, txnItem[T]{v, present})
+}
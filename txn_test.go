@@ -0,0 +1,138 @@
+package radix_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/gobwas/radix"
+)
+
+func TestTxnCommit(t *testing.T) {
+	a := PathFromMapStr(map[uint]string{1: "a"})
+	b := PathFromMapStr(map[uint]string{1: "b", 2: "c"})
+
+	for _, test := range []struct {
+		name   string
+		before []item
+		txn    func(*Txn)
+		err    error
+		expect map[uint]string
+	}{
+		{
+			name: "insert",
+			txn: func(x *Txn) {
+				x.Insert(a, 1)
+				x.Insert(b, 2)
+			},
+			expect: map[uint]string{1: a.String(), 2: b.String()},
+		},
+		{
+			name:   "delete inserted",
+			before: []item{{pairs{{1, "a"}}, 1}},
+			txn: func(x *Txn) {
+				x.Insert(b, 2)
+				x.Delete(b, 2)
+				x.Delete(a, 1)
+			},
+			expect: map[uint]string{},
+		},
+		{
+			name:   "move",
+			before: []item{{pairs{{1, "a"}}, 1}},
+			txn: func(x *Txn) {
+				x.Move(a, b, 1)
+				x.Insert(a, 2)
+			},
+			expect: map[uint]string{1: b.String(), 2: a.String()},
+		},
+		{
+			name:   "delete missing",
+			before: []item{{pairs{{1, "a"}}, 1}},
+			txn: func(x *Txn) {
+				x.Insert(b, 2)
+				x.Delete(a, 1)
+				x.Delete(a, 1)
+			},
+			err:    ErrNotFound,
+			expect: map[uint]string{1: a.String()},
+		},
+		{
+			name:   "move missing",
+			before: []item{{pairs{{1, "a"}}, 1}},
+			txn: func(x *Txn) {
+				x.Move(a, b, 1)
+				x.Move(a, b, 1)
+			},
+			err:    ErrNotFound,
+			expect: map[uint]string{1: a.String()},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			trie := New(nil)
+			for _, op := range test.before {
+				trie.Insert(PathFromSliceStr(op.p), op.v)
+			}
+			x := trie.Txn()
+			test.txn(x)
+			if err := x.Commit(); !errors.Is(err, test.err) {
+				t.Fatalf("Commit() = %v; want %v", err, test.err)
+			}
+			if err := x.Commit(); err != ErrTxnDone {
+				t.Errorf("repeated Commit() = %v; want %v", err, ErrTxnDone)
+			}
+			act := map[uint]string{}
+			trie.ForEach(Path{}, func(trace []PairStr, v uint) bool {
+				act[v] = PathFromSliceStr(trace).String()
+				return true
+			})
+			if !reflect.DeepEqual(act, test.expect) {
+				t.Errorf("after Commit() items are %v; want %v", act, test.expect)
+			}
+		})
+	}
+}
+
+func TestTxnIsolation(t *testing.T) {
+	trie := New(nil)
+	p := PathFromMapStr(map[uint]string{1: "a"})
+
+	x := trie.Txn()
+	x.Insert(p, 1)
+	if n := trie.ItemCount(Path{}); n != 0 {
+		t.Errorf("ItemCount() before Commit() = %d; want 0", n)
+	}
+	x.Rollback()
+	if err := x.Commit(); err != ErrTxnDone {
+		t.Errorf("Commit() after Rollback() = %v; want %v", err, ErrTxnDone)
+	}
+	if n := trie.ItemCount(Path{}); n != 0 {
+		t.Errorf("ItemCount() after Rollback() = %d; want 0", n)
+	}
+
+	const n = 100
+	x = trie.Txn()
+	for i := 0; i < n; i++ {
+		x.Insert(p, uint(i))
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := x.Commit(); err != nil {
+			t.Errorf("Commit() = %v", err)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			if c := trie.ItemCount(Path{}); c != n {
+				t.Errorf("ItemCount() after Commit() = %d; want %d", c, n)
+			}
+			return
+		default:
+		}
+		if c := trie.ItemCount(Path{}); c != 0 && c != n {
+			t.Fatalf("ItemCount() during Commit() = %d; want 0 or %d", c, n)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package radix
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrVersionNotFound is returned when requested version of a trie is not
+// created yet or is already pruned by the retention policy.
+var ErrVersionNotFound = errors.New("radix: version not found")
+
+// history holds roots of the versioned trie.
+type history[T any] struct {
+	mu       sync.RWMutex
+	versions []version[T]
+
+	keepVersions int
+	keepDuration time.Duration
+	now          func() time.Time
+}
+
+type version[T any] struct {
+	num  uint64
+	time time.Time
+	root *LeafOf[T]
+}
+
+func newHistory[T any](root *LeafOf[T], config *TrieConfig) *history[T] {
+	h := &history[T]{
+		keepVersions: config.KeepVersions,
+		keepDuration: config.KeepDuration,
+		now:          time.Now,
+	}
+	h.versions = []version[T]{{
+		time: h.now(),
+		root: root,
+	}}
+	return h
+}
+
+// commit makes root the next version and prunes versions which are out of
+// the retention policy.
+func (h *history[T]) commit(root *LeafOf[T]) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	last := h.versions[len(h.versions)-1]
+	h.versions = append(h.versions, version[T]{
+		num:  last.num + 1,
+		time: now,
+		root: root,
+	})
+	h.prune(now)
+}
+
+// prune drops versions which are out of the retention policy. The latest
+// version is never dropped.
+// Caller must hold h.mu.
+func (h *history[T]) prune(now time.Time) {
+	var n int
+	if k := h.keepVersions; k > 0 && len(h.versions) > k {
+		n = len(h.versions) - k
+	}
+	if d := h.keepDuration; d > 0 {
+		// Version is kept while it was the latest one at some moment within
+		// the duration.
+		for n < len(h.versions)-1 && now.Sub(h.versions[n+1].time) > d {
+			n++
+		}
+	}
+	if n == 0 {
+		return
+	}
+	m := copy(h.versions, h.versions[n:])
+	clear(h.versions[m:])
+	h.versions = h.versions[:m]
+}
+
+func (h *history[T]) current() uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.versions[len(h.versions)-1].num
+}
+
+func (h *history[T]) root(num uint64) (*LeafOf[T], bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	first := h.versions[0].num
+	if num < first || num-first >= uint64(len(h.versions)) {
+		return nil, false
+	}
+	return h.versions[num-first].root, true
+}
+
+// Version returns current version of the trie. Version is increased by every
+// mutation call which changes the trie; the initial version is zero.
+// It panics if trie was created without TrieConfig.Versioned option.
+func (t *TrieOf[T]) Version() uint64 {
+	return t.mustHistory().current()
+}
+
+// SnapshotAt returns read-only trie at given version. Note that returned trie
+// has no reverse index.
+// It returns ErrVersionNotFound if there is no such version.
+// It panics if trie was created without TrieConfig.Versioned option.
+func (t *TrieOf[T]) SnapshotAt(version uint64) (*TrieOf[T], error) {
+	root, ok := t.mustHistory().root(version)
+	if !ok {
+		return nil, ErrVersionNotFound
+	}
+	s := &TrieOf[T]{
+		inserter:   t.inserter,
+		persistent: true,
+		readonly:   true,
+	}
+	s.root.Store(root)
+	return s, nil
+}
+
+// LookupStrictAt is like LookupStrict but searches the trie at given version.
+// It returns ErrVersionNotFound if there is no such version.
+func (t *TrieOf[T]) LookupStrictAt(version uint64, query Path, it func(T) bool) error {
+	root, ok := t.mustHistory().root(version)
+	if !ok {
+		return ErrVersionNotFound
+	}
+	Lookup(root, query, LookupStrategyStrict, func(l *LeafOf[T]) bool {
+		return l.Ascend(it)
+	})
+	return nil
+}
+
+// SelectAt calls Select with root leaf of the trie at given version.
+// It returns ErrVersionNotFound if there is no such version.
+func (t *TrieOf[T]) SelectAt(version uint64, query Path, wildcard Wildcard, s LookupStrategy, it func(Wildcard, T) bool) error {
+	root, ok := t.mustHistory().root(version)
+	if !ok {
+		return ErrVersionNotFound
+	}
+	Select(root, query, wildcard, s, func(captured Wildcard, leaf *LeafOf[T]) bool {
+		return leaf.Ascend(func(val T) bool {
+			return it(captured, val)
+		})
+	})
+	return nil
+}
+
+func (t *TrieOf[T]) mustHistory() *history[T] {
+	if t.history == nil {
+		panic("radix: versioning is not enabled")
+	}
+	return t.history
+}
@@ -0,0 +1,69 @@
+package radix_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/gobwas/radix"
+)
+
+func TestTrieVersioned(t *testing.T) {
+	trie := New(&TrieConfig{Versioned: true})
+	if v := trie.Version(); v != 0 {
+		t.Fatalf("initial Version() = %d; want 0", v)
+	}
+
+	a := PathFromMapStr(map[uint]string{1: "a"})
+	b := PathFromMapStr(map[uint]string{1: "b"})
+	trie.Insert(a, 1)   // v1
+	trie.Insert(a, 2)   // v2
+	trie.Move(a, b, 1)  // v3
+	trie.Delete(a, 3)   // Nothing is changed.
+	trie.Insert(a, 2)   // Nothing is changed.
+	trie.Txn().Commit() // Nothing is changed.
+	if v := trie.Version(); v != 3 {
+		t.Fatalf("Version() = %d; want 3", v)
+	}
+
+	for _, test := range []struct {
+		version uint64
+		query   Path
+		exp     []uint
+	}{
+		{0, a, nil},
+		{1, a, []uint{1}},
+		{2, a, []uint{1, 2}},
+		{3, a, []uint{2}},
+		{2, b, nil},
+		{3, b, []uint{1}},
+	} {
+		var act []uint
+		err := trie.LookupStrictAt(test.version, test.query, func(v uint) bool {
+			act = append(act, v)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(act, test.exp) {
+			t.Errorf("LookupStrictAt(%d, %v) = %v; want %v", test.version, test.query, act, test.exp)
+		}
+	}
+
+	selected := map[string][]uint{}
+	err := trie.SelectAt(2, Path{}, NewWildcard(1), LookupStrategyGreedy, func(w Wildcard, v uint) bool {
+		selected[w[1]] = append(selected[w[1]], v)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := map[string][]uint{"a": {1, 2}}; !reflect.DeepEqual(selected, exp) {
+		t.Errorf("SelectAt(2) = %v; want %v", selected, exp)
+	}
+
+	if err := trie.LookupStrictAt(4, a, nil); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("LookupStrictAt(4) error = %v; want %v", err, ErrVersionNotFound)
+	}
+}
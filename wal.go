@@ -0,0 +1,482 @@
+package radix
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+	"time"
+)
+
+// Write-ahead log is a sequence of frames. Every frame holds all changes made
+// by one trie mutation and is written at once:
+//
+//	frame    = size checksum header *record
+//	size     = uint32 size of records in big endian
+//	checksum = uint32 CRC-32C of records in big endian
+//	header   = uint32 CRC-32C of size and checksum in big endian
+//	record   = insert / delete / clear
+//	insert   = %x01 path item / %x02 path item bytes
+//	delete   = %x03 path item
+//	clear    = %x04
+//	path     = count(pairs) *(uvarint(key) bytes)
+//	item     = uvarint(zigzag(item))
+//	bytes    = count(data) data
+//	count    = uvarint
+//
+// Header checksum makes possible to tell corrupted size of a frame from the
+// frame torn by a crash.
+//
+// Records are idempotent assignments of (path, item) pairs presence. Thus
+// replaying the log on top of a snapshot taken at any moment after the log
+// was started gives the same result as replaying it on top of the empty trie.
+const (
+	walInsert byte = iota + 1
+	walInsertWithPayload
+	walDelete
+	walClear
+
+	walHeaderSize = 12
+)
+
+// WALSync describes how often write-ahead log is synced to a stable storage.
+type WALSync int
+
+const (
+	// WALSyncAlways syncs the log after every trie mutation.
+	WALSyncAlways WALSync = iota
+
+	// WALSyncPeriodic syncs the log after trie mutation if at least
+	// WAL.SyncPeriod passed since the last sync.
+	WALSyncPeriodic
+
+	// WALSyncNever never syncs the log, leaving it to the operating system.
+	WALSyncNever
+)
+
+// WAL is a write-ahead log of trie mutations. See TrieConfig.WAL.
+//
+// WAL must not be shared between tries.
+type WAL struct {
+	// EncodePayload is used to encode non-nil item payloads. If it is nil,
+	// mutations with payloads could not be logged.
+	EncodePayload func(any) ([]byte, error)
+
+	// DecodePayload is used by Recover to decode item payloads.
+	DecodePayload func([]byte) (any, error)
+
+	// SyncPeriod is used with WALSyncPeriodic policy.
+	SyncPeriod time.Duration
+
+	mu     sync.Mutex
+	w      io.Writer
+	policy WALSync
+	synced time.Time
+	err    error
+}
+
+// NewWAL creates write-ahead log appending to w. If w has Sync() error
+// method (as *os.File does), it is called with respect to given policy.
+func NewWAL(w io.Writer, policy WALSync) *WAL {
+	return &WAL{
+		w:      w,
+		policy: policy,
+		synced: time.Now(),
+	}
+}
+
+// Sync syncs the log to a stable storage regardless of the policy. It
+// returns Err() if it is not nil.
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = w.sync()
+	}
+	return w.err
+}
+
+// Err returns the first error occurred while logging trie mutations.
+//
+// Trie mutations are applied even if they could not be logged. Once an error
+// occurs, nothing is written to the log anymore; that is, the log never has
+// gaps in it.
+func (w *WAL) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *WAL) write(frame []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return
+	}
+	if _, err := w.w.Write(frame); err != nil {
+		w.err = err
+		return
+	}
+	switch w.policy {
+	case WALSyncAlways:
+		w.err = w.sync()
+	case WALSyncPeriodic:
+		if time.Since(w.synced) >= w.SyncPeriod {
+			w.err = w.sync()
+		}
+	}
+}
+
+func (w *WAL) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *WAL) sync() error {
+	if s, ok := w.w.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil {
+			return err
+		}
+	}
+	w.synced = time.Now()
+	return nil
+}
+
+// walLog collects records of the trie mutation into a frame.
+type walLog[T any] struct {
+	mu   sync.Mutex
+	wal  *WAL
+	conv itemConv[T]
+	buf  []byte
+	err  error
+}
+
+func newWALLog[T any](wal *WAL) *walLog[T] {
+	conv, ok := itemConvOf[T]()
+	if !ok {
+		panic(fmt.Sprintf("radix: could not log items of type %T", *new(T)))
+	}
+	return &walLog[T]{
+		wal:  wal,
+		conv: conv,
+	}
+}
+
+// begin starts new frame. It blocks until frame started by other goroutine
+// is ended.
+func (l *walLog[T]) begin() {
+	l.mu.Lock()
+	l.buf = append(l.buf[:0], make([]byte, walHeaderSize)...)
+	l.err = nil
+}
+
+// end writes frame started by begin if anything was changed.
+func (l *walLog[T]) end() {
+	defer l.mu.Unlock()
+	if l.err != nil {
+		l.wal.fail(l.err)
+		return
+	}
+	if len(l.buf) == walHeaderSize {
+		return
+	}
+	records := l.buf[walHeaderSize:]
+	binary.BigEndian.PutUint32(l.buf[0:], uint32(len(records)))
+	binary.BigEndian.PutUint32(l.buf[4:], crc32.Checksum(records, crcTable))
+	binary.BigEndian.PutUint32(l.buf[8:], crc32.Checksum(l.buf[:8], crcTable))
+	l.wal.write(l.buf)
+}
+
+func (l *walLog[T]) insert(p Path, v T, payload any) {
+	if payload == nil {
+		l.record(walInsert, p, v)
+		return
+	}
+	if l.wal.EncodePayload == nil {
+		l.err = fmt.Errorf("radix: could not log payload of %v: EncodePayload is not set", v)
+		return
+	}
+	data, err := l.wal.EncodePayload(payload)
+	if err != nil {
+		l.err = fmt.Errorf("radix: could not log payload of %v: %w", v, err)
+		return
+	}
+	l.record(walInsertWithPayload, p, v)
+	l.buf = binary.AppendUvarint(l.buf, uint64(len(data)))
+	l.buf = append(l.buf, data...)
+}
+
+func (l *walLog[T]) delete(p Path, v T) {
+	l.record(walDelete, p, v)
+}
+
+// reset records replacement of all trie contents with the tree starting at
+// root.
+func (l *walLog[T]) reset(root *LeafOf[T]) {
+	l.buf = append(l.buf, walClear)
+	Dig(root, leafVisitor[T](func(trace []PairStr, leaf *LeafOf[T]) bool {
+		p := PathFromSliceStr(trace)
+		leaf.AscendWithPayload(func(v T, payload any) bool {
+			l.insert(p, v, payload)
+			return l.err == nil
+		})
+		return l.err == nil
+	}))
+}
+
+func (l *walLog[T]) record(op byte, p Path, v T) {
+	l.buf = append(l.buf, op)
+	l.buf = appendPath(l.buf, p)
+	l.buf = binary.AppendUvarint(l.buf, zigzag(l.conv.to(v)))
+}
+
+// Recover restores trie of uint items from snapshot and write-ahead log.
+// See RecoverOf for details.
+func Recover(snapshot, wal io.Reader, config *TrieConfig) (*Trie, error) {
+	return RecoverOf(snapshot, wal, config, cmp.Compare[uint])
+}
+
+// RecoverOf restores trie of items of type T by reading snapshot written by
+// EncoderOf (or MarshalBinary) and replaying write-ahead log on top of it.
+// Either of snapshot and wal could be nil. If config has WAL, its
+// DecodePayload is used to decode item payloads and further mutations of
+// returned trie are logged by it (but not the replayed ones).
+//
+// Log is read until its end. Torn frame at the end of the log (which is left
+// by a crash during write) is ignored. If wal has Truncate(int64) error method
+// (as *os.File does), the log is truncated to drop that frame. If wal is an
+// io.Seeker, it is positioned at the end of the log, so the same file could
+// be used to continue logging.
+//
+// It returns error wrapping ErrChecksum if some frame in the middle of the log
+// or header of any frame is corrupted, and ErrInvalidFormat if the log is
+// malformed.
+func RecoverOf[T any](snapshot, wal io.Reader, config *TrieConfig, compare func(a, b T) int) (*TrieOf[T], error) {
+	conv, ok := itemConvOf[T]()
+	if !ok {
+		return nil, fmt.Errorf("radix: could not recover items of type %T", *new(T))
+	}
+	var c TrieConfig
+	if config != nil {
+		c = *config
+	}
+	log := c.WAL
+	c.WAL = nil
+
+	var decodePayload func([]byte) (any, error)
+	if log != nil {
+		decodePayload = log.DecodePayload
+	}
+	t := NewOf(&c, compare)
+	if snapshot != nil {
+		dec := NewDecoderOf[T](snapshot)
+		dec.DecodePayload = decodePayload
+		if err := dec.Decode(t); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	if wal != nil {
+		r := walReader[T]{
+			trie:          t,
+			conv:          conv,
+			decodePayload: decodePayload,
+		}
+		if err := r.replay(wal); err != nil {
+			return nil, err
+		}
+	}
+	if log != nil {
+		t.log = newWALLog[T](log)
+	}
+	return t, nil
+}
+
+type walReader[T any] struct {
+	trie          *TrieOf[T]
+	conv          itemConv[T]
+	decodePayload func([]byte) (any, error)
+}
+
+type walRecord[T any] struct {
+	op      byte
+	path    Path
+	item    T
+	payload any
+}
+
+func (w *walReader[T]) replay(src io.Reader) error {
+	var (
+		r      = bufio.NewReader(src)
+		header [walHeaderSize]byte
+		frame  bytes.Buffer
+		offset int64
+	)
+	for {
+		_, err := io.ReadFull(r, header[:])
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			return truncateWAL(src, offset)
+		}
+		if err != nil {
+			return err
+		}
+		if crc32.Checksum(header[:8], crcTable) != binary.BigEndian.Uint32(header[8:]) {
+			return fmt.Errorf("%w: write-ahead log frame header at %d", ErrChecksum, offset)
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:]))
+		frame.Reset()
+		// Frame is not read at once to not allocate the garbage size of
+		// the torn frame.
+		if n, err := io.CopyN(&frame, r, size); n < size {
+			if err == io.EOF {
+				return truncateWAL(src, offset)
+			}
+			return err
+		}
+		if crc32.Checksum(frame.Bytes(), crcTable) != binary.BigEndian.Uint32(header[4:]) {
+			_, err := r.Peek(1)
+			if err == io.EOF {
+				return truncateWAL(src, offset)
+			}
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("%w: write-ahead log frame at %d", ErrChecksum, offset)
+		}
+		records, err := w.decode(frame.Bytes())
+		if err != nil {
+			return fmt.Errorf("%w: write-ahead log frame at %d: %w", ErrInvalidFormat, offset, err)
+		}
+		w.apply(records)
+		offset += walHeaderSize + size
+	}
+}
+
+func truncateWAL(wal io.Reader, size int64) error {
+	if f, ok := wal.(interface{ Truncate(int64) error }); ok {
+		if err := f.Truncate(size); err != nil {
+			return err
+		}
+	}
+	if s, ok := wal.(io.Seeker); ok {
+		if _, err := s.Seek(size, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply applies all records at once.
+func (w *walReader[T]) apply(records []walRecord[T]) {
+	t := w.trie
+	t.beginWrite(true)
+	defer t.endWrite(true)
+
+	for _, r := range records {
+		switch r.op {
+		case walInsert, walInsertWithPayload:
+			t.insertExact(r.path, r.item, r.payload)
+		case walDelete:
+			t.remove(nil, r.path, r.item, true)
+		case walClear:
+			t.replaceRoot(t.newRoot())
+		}
+	}
+}
+
+func (w *walReader[T]) decode(data []byte) (records []walRecord[T], err error) {
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		var rec walRecord[T]
+		rec.op, _ = r.ReadByte()
+		switch rec.op {
+		case walClear:
+			records = append(records, rec)
+			continue
+		case walInsert, walInsertWithPayload, walDelete:
+		default:
+			return nil, fmt.Errorf("unknown record type: %#x", rec.op)
+		}
+		if rec.path, err = readPath(r); err != nil {
+			return nil, err
+		}
+		x, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		rec.item = w.conv.from(unzigzag(x))
+		if rec.op == walInsertWithPayload {
+			p, err := readBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			if w.decodePayload == nil {
+				return nil, fmt.Errorf("could not decode payload of %v: DecodePayload is not set", rec.item)
+			}
+			if rec.payload, err = w.decodePayload(p); err != nil {
+				return nil, fmt.Errorf("could not decode payload of %v: %w", rec.item, err)
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func appendPath(b []byte, p Path) []byte {
+	b = binary.AppendUvarint(b, uint64(p.Len()))
+	p.Ascend(p.Begin(), func(pair Pair) bool {
+		b = binary.AppendUvarint(b, uint64(pair.Key))
+		b = binary.AppendUvarint(b, uint64(len(pair.Value)))
+		b = append(b, pair.Value...)
+		return true
+	})
+	return b
+}
+
+func readPath(r *bytes.Reader) (Path, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Path{}, err
+	}
+	if n > MaxPathSize {
+		return Path{}, fmt.Errorf("path is too long: %d keys", n)
+	}
+	pairs := make([]Pair, n)
+	for i := range pairs {
+		k, err := binary.ReadUvarint(r)
+		if err != nil {
+			return Path{}, err
+		}
+		if i > 0 && k <= uint64(pairs[i-1].Key) {
+			return Path{}, fmt.Errorf("path keys are not ordered")
+		}
+		v, err := readBytes(r)
+		if err != nil {
+			return Path{}, err
+		}
+		pairs[i] = Pair{uint(k), v}
+	}
+	return PathFromSliceBorrow(pairs), nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	p := make([]byte, n)
+	r.Read(p)
+	return p, nil
+}
@@ -0,0 +1,203 @@
+package radix_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	. "github.com/gobwas/radix"
+)
+
+func TestRecover(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config TrieConfig
+	}{
+		{"default", TrieConfig{}},
+		{"order", TrieConfig{NodeOrder: []uint{3, 1}}},
+		{"persistent", TrieConfig{Persistent: true}},
+		{"index", TrieConfig{ReverseIndex: true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var log bytes.Buffer
+			config := test.config
+			config.WAL = newTestWAL(&log)
+			trie := New(&config)
+
+			var snapshot []byte
+			entries := randEntries(300)
+			for i, e := range entries {
+				d := entries[rand.Intn(i+1)]
+				trie.InsertWithPayload(e.Path, e.Item, e.Payload)
+				if i%3 == 0 {
+					trie.Delete(d.Path, d.Item)
+				}
+				if i%5 == 0 {
+					trie.Move(d.Path, PathFromMapStr(map[uint]string{7: "moved"}), d.Item)
+				}
+				if i == len(entries)/2 {
+					var buf bytes.Buffer
+					enc := NewEncoder(&buf)
+					enc.EncodePayload = encodeIntPayload
+					if err := enc.Encode(trie); err != nil {
+						t.Fatal(err)
+					}
+					snapshot = buf.Bytes()
+				}
+			}
+			x := trie.Txn()
+			x.Insert(PathFromMapStr(map[uint]string{1: "txn"}), 1)
+			x.Delete(entries[0].Path, entries[0].Item)
+			x.Commit()
+			if !config.Persistent {
+				leaf := trie.At(PathFromMapStr(map[uint]string{2: "v0"}))
+				trie.InsertTo(leaf, PathFromMapStr(map[uint]string{4: "v1"}), 42)
+			}
+			if err := config.WAL.Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, snapshot := range [][]byte{nil, snapshot} {
+				var s io.Reader
+				if snapshot != nil {
+					s = bytes.NewReader(snapshot)
+				}
+				config := test.config
+				config.WAL = newTestWAL(io.Discard)
+				act, err := Recover(s, bytes.NewReader(log.Bytes()), &config)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if a, b := trieItems(act), trieItems(trie); !reflect.DeepEqual(a, b) {
+					t.Fatalf("recovered trie items = %v; want %v", a, b)
+				}
+				if a, b := canonicalPayloads(act), canonicalPayloads(trie); !reflect.DeepEqual(a, b) {
+					t.Fatalf("recovered trie payloads = %v; want %v", a, b)
+				}
+			}
+		})
+	}
+}
+
+func TestRecoverTornTail(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "wal")
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	trie := New(&TrieConfig{WAL: NewWAL(file, WALSyncAlways)})
+	a := PathFromMapStr(map[uint]string{1: "a"})
+	trie.Insert(a, 1)
+	trie.Insert(a, 2)
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trie.Insert(a, 3)
+	// Simulate crash during the last write.
+	if err := file.Truncate(info.Size() + 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	trie, err = Recover(nil, file, &TrieConfig{WAL: NewWAL(file, WALSyncAlways)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act, err := file.Stat(); err != nil {
+		t.Fatal(err)
+	} else if act.Size() != info.Size() {
+		t.Fatalf("log was truncated to %d bytes; want %d", act.Size(), info.Size())
+	}
+	trie.Insert(a, 4)
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	trie, err = Recover(nil, file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var act []uint
+	trie.LookupStrict(a, func(v uint) bool {
+		act = append(act, v)
+		return true
+	})
+	if exp := []uint{1, 2, 4}; !reflect.DeepEqual(act, exp) {
+		t.Errorf("recovered items = %v; want %v", act, exp)
+	}
+}
+
+func TestRecoverCorrupted(t *testing.T) {
+	var log bytes.Buffer
+	trie := New(&TrieConfig{WAL: NewWAL(&log, WALSyncNever)})
+	for i := uint(0); i < 3; i++ {
+		trie.Insert(PathFromMapStr(map[uint]string{1: "a"}), i)
+	}
+	for _, test := range []struct {
+		name    string
+		corrupt func([]byte)
+	}{
+		{
+			name: "records",
+			corrupt: func(data []byte) {
+				// Corrupt the last record byte of the first frame.
+				data[len(data)-1-2*(len(data)/3)]++
+			},
+		},
+		{
+			name: "size",
+			corrupt: func(data []byte) {
+				// Make size of the first frame exceed the log size, so
+				// it looks like a torn frame if header is not checked.
+				data[1] ^= 0x10
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data := bytes.Clone(log.Bytes())
+			test.corrupt(data)
+
+			_, err := Recover(nil, bytes.NewReader(data), nil)
+			if !errors.Is(err, ErrChecksum) {
+				t.Errorf("Recover() error = %v; want %v", err, ErrChecksum)
+			}
+		})
+	}
+}
+
+func newTestWAL(w io.Writer) *WAL {
+	wal := NewWAL(w, WALSyncNever)
+	wal.EncodePayload = encodeIntPayload
+	wal.DecodePayload = decodeIntPayload
+	return wal
+}
+
+func encodeIntPayload(p any) ([]byte, error) {
+	return []byte(strconv.Itoa(p.(int))), nil
+}
+
+func canonicalPayloads(trie *Trie) map[string]int {
+	m := map[string]int{}
+	trie.Walk(Path{}, VisitorFunc(
+		func(trace []PairStr, l *Leaf) bool {
+			return l.AscendWithPayload(func(v uint, p any) bool {
+				m[fmt.Sprint(PathFromSliceStr(trace), v, p)]++
+				return true
+			})
+		},
+		nil,
+	))
+	return m
+}